@@ -1,114 +1,515 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"linkding-media-archiver/internal/configuration"
+	"linkding-media-archiver/internal/disk"
+	"linkding-media-archiver/internal/health"
+	"linkding-media-archiver/internal/hooks"
 	"linkding-media-archiver/internal/job"
 	"linkding-media-archiver/internal/linkding"
 	"linkding-media-archiver/internal/logging"
+	"linkding-media-archiver/internal/metrics"
+	"linkding-media-archiver/internal/notify"
+	"linkding-media-archiver/internal/ratelimit"
+	"linkding-media-archiver/internal/schedule"
 	"linkding-media-archiver/internal/semver"
+	"linkding-media-archiver/internal/server"
+	"linkding-media-archiver/internal/state"
+	"linkding-media-archiver/internal/trigger"
 	"linkding-media-archiver/internal/ytdlp"
 	"log"
 	"log/slog"
+	"maps"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // Allow setting the time zone of schedules with TZ in images without time zone data
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
+const (
+	exitSuccess        = 0
+	exitError          = 1
+	exitPartialFailure = 2
+	exitTotalFailure   = 3
+)
+
+// A Linkding instance or account with everything needed to process its bookmarks
+type target struct {
+	name     string
+	tags     []string
+	bundleId int
+	client   *linkding.Client
+	ytdlp    *ytdlp.Ytdlp
+	store    *state.Store
+	logger   *slog.Logger
+	lastScan time.Time
+}
+
+// Every run downloads into a directory of its own within the work directory, which is swept on startup
+const tempDirPattern = "linkding-media-archiver-"
+
+// Webhooks that are still being delivered on exit get this long to finish
+const webhookExitTimeout = 10 * time.Second
+
 func main() {
 	godotenv.Load()
 
 	isDryRun := flag.Bool("n", false, "Dry run: download media but do not actually upload it to Linkding")
 	isSingleRun := flag.Bool("s", false, "Single run: exit after processing bookmarks once")
+	configPath := flag.String("c", os.Getenv("LDMA_CONFIG"), "Configuration file: read settings from this YAML file, environment variables take precedence")
 	flag.Parse()
 
-	config := configuration.ReadConfiguration()
+	config, err := configuration.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	logger := logging.NewLogger(config.LogLevel)
 	slog.SetDefault(logger)
 
-	client := createLinkdingClient(config)
-	minVersion := semver.Semver{Major: 1, Minor: 44}
-	checkLinkdingVersion(client, minVersion)
+	switch flag.Arg(0) {
+	case "healthcheck":
+		os.Exit(runHealthcheck(config))
+	case "config":
+		os.Exit(runConfig(config, flag.Arg(1)))
+	}
+
+	ctx := onInterrupt()
 
-	tempdir := createTempDir()
+	tempdir := createTempDir(config.WorkDir)
+	webhooks := notify.NewNotifier(config.WebhookUrls, config.WebhookSecret, config.WebhookRetries)
 	cleanupAndExit := func(code int) {
 		os.RemoveAll(tempdir)
+
+		if !webhooks.Wait(webhookExitTimeout) {
+			logger.Warn("Gave up waiting for webhooks to be delivered", "timeout", webhookExitTimeout)
+		}
+
 		os.Exit(code)
 	}
-	onInterrupt(cleanupAndExit)
 
-	ytdlp := ytdlp.NewYtdlp(tempdir, config.YtdlpFormat)
-	sleep := time.NewTicker(config.ScanInterval)
+	targets := createTargets(ctx, config, tempdir)
+	scheduler := schedule.Scheduler{Cron: config.Schedule, Interval: config.ScanInterval, Window: config.DownloadWindow}
+	monitor := health.NewMonitor(time.Duration(config.HealthMaxIntervals)*scheduler.Period(time.Now()), config.HealthMaxStall, time.Now())
+	triggers := trigger.New()
+	triggers.OnSignal(ctx)
+	startServer(ctx, config, targets, monitor, triggers)
 
-	var lastScan time.Time
+	// Scan immediately and then as scheduled or triggered until interrupted, one run at a time
+	triggers.Scan()
 
-	// Run immediately and then on every tick
-	for ; true; <-sleep.C {
+	for isRunning := true; isRunning; isRunning = waitForTrigger(ctx, scheduler, triggers) {
+		request := triggers.Take()
 		timeBeforeRun := time.Now()
 
-		if config.SkipExistingBookmarks && lastScan.IsZero() {
-			logger.Info("Waiting for initial scan", "scanInterval", config.ScanInterval)
-			lastScan = timeBeforeRun
+		// All targets start out together, so they skip their existing bookmarks together
+		if request.Scan && config.SkipExistingBookmarks && targets[0].lastScan.IsZero() {
+			logger.Info("Skipping existing bookmarks until the next scan")
+
+			for _, target := range targets {
+				target.lastScan = timeBeforeRun
+			}
+
+			monitor.RunFinished(timeBeforeRun, true)
+			request.Scan = false
+		}
+
+		if request.IsEmpty() {
 			continue
 		}
 
-		jobConfig := job.JobConfiguration{
-			Tags:               config.Tags,
-			BundleId:           config.BundleId,
-			UpdateBookmarkText: config.UpdateBookmarkText,
-			IsDryRun:           *isDryRun,
-			LastScan:           lastScan,
+		monitor.RunStarted(timeBeforeRun)
+		results := make([]*job.RunResult, 0, len(targets))
+		var runErr error
+
+		// Targets are processed one after another, so the worker and bandwidth limits hold across all of them
+		for _, target := range targets {
+			bookmarkIds := request.BookmarkIds[target.name]
+			if !request.Scan && len(bookmarkIds) == 0 {
+				continue
+			}
+
+			jobConfig := getJobConfiguration(config, target, *isDryRun)
+			jobConfig.Webhooks = webhooks
+			jobConfig.OnProgress = monitor.Progress
+			jobConfig.BookmarkIds = bookmarkIds
+			jobConfig.SkipScan = !request.Scan
+
+			result, err := job.ProcessBookmarks(logging.WithContext(ctx, target.logger), target.client, target.ytdlp, target.store, jobConfig)
+			results = append(results, result)
+			runErr = errors.Join(runErr, err)
+
+			if err == nil && request.Scan {
+				target.lastScan = timeBeforeRun // Only update last scan time when bookmarks were actually processed
+				metrics.LastSuccessfulScan.SetToCurrentTime(target.name)
+			} else if errors.Is(err, job.ErrWindowEnded) {
+				target.logger.Info("Download window ended, remaining bookmarks are processed in the next window")
+			} else if err != nil {
+				target.logger.Error("Error processing bookmarks", "error", err)
+			}
+
+			if config.ReportFile != "" {
+				path := getReportFile(config.ReportFile, target.name)
+				if err := result.WriteFile(path); err != nil {
+					target.logger.Error("Failed to write report", "path", path, "error", err)
+				}
+			}
+
+			if ctx.Err() != nil {
+				break
+			}
 		}
-		err := job.ProcessBookmarks(client, ytdlp, jobConfig)
 
-		if err == nil {
-			lastScan = timeBeforeRun // Only update last scan time when bookmarks were actually processed
-		} else {
-			logger.Error("Error processing bookmarks", "error", err)
+		monitor.RunFinished(time.Now(), runErr == nil && request.Scan)
+
+		if ctx.Err() != nil {
+			break
 		}
 
 		if *isSingleRun {
-			cleanupAndExit(0)
+			cleanupAndExit(getExitCode(results, runErr))
 		}
+	}
+
+	logger.Info("Stopped")
+	cleanupAndExit(exitError)
+}
+
+func waitForTrigger(ctx context.Context, scheduler schedule.Scheduler, triggers *trigger.Trigger) bool {
+	var scheduled <-chan time.Time
 
-		logger.Info("Waiting for next scan", "scanInterval", config.ScanInterval)
+	// A cron expression may never match again, in which case only triggers start runs
+	if next := scheduler.Next(time.Now()); !next.IsZero() {
+		slog.Info("Waiting for next scan", "nextScan", next)
+		timer := time.NewTimer(time.Until(next))
+		defer timer.Stop()
+
+		scheduled = timer.C
+	} else {
+		slog.Info("No more scans scheduled, waiting for triggers")
 	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-scheduled:
+		triggers.Scan()
+		return true
+	case <-triggers.C():
+		return true
+	}
+}
+
+func getExitCode(results []*job.RunResult, err error) int {
+	if err != nil {
+		return exitError
+	}
+
+	failed, total := 0, 0
+
+	for _, result := range results {
+		failed += result.Count(job.OutcomeFailed)
+		total += len(result.Bookmarks)
+	}
+
+	switch {
+	case failed == 0:
+		return exitSuccess
+	case failed == total:
+		return exitTotalFailure
+	default:
+		return exitPartialFailure
+	}
+}
+
+// Reports of named targets get the name added to the file name, so they don't overwrite each other
+func getReportFile(path string, targetName string) string {
+	if targetName == "" {
+		return path
+	}
+
+	extension := filepath.Ext(path)
+	return strings.TrimSuffix(path, extension) + "-" + targetName + extension
 }
 
-func createLinkdingClient(config configuration.Configuration) *linkding.Client {
-	client, err := linkding.NewClient(config.LinkdingBaseUrl, config.LinkdingToken)
+func getJobConfiguration(config configuration.Configuration, target *target, isDryRun bool) job.JobConfiguration {
+	return job.JobConfiguration{
+		Target:             target.name,
+		Tags:               target.tags,
+		BundleId:           target.bundleId,
+		UpdateBookmarkText: config.UpdateBookmarkText,
+		IsDryRun:           isDryRun,
+		LastScan:           target.lastScan,
+		DownloadWorkers:    config.DownloadWorkers,
+		UploadWorkers:      config.UploadWorkers,
+		StatusTags:         getStatusTags(config),
+		MediaTags: job.MediaTagOptions{
+			Enabled:  config.MediaTags,
+			Allow:    config.MediaTagsAllow,
+			Deny:     config.MediaTagsDeny,
+			Prefix:   config.MediaTagsPrefix,
+			MaxCount: config.MediaTagsMax,
+		},
+		GracePeriod: config.ShutdownGracePeriod,
+		Extractors:  getExtractorFilter(config),
+		Probe: job.ProbeRules{
+			Enabled:       config.Probe,
+			SkipLive:      config.SkipLive,
+			SkipPlaylists: config.SkipPlaylists,
+		},
+		Profiles:       config.Profiles,
+		ProfileTags:    getProfileTags(config),
+		DefaultProfile: config.DefaultProfile,
+		Deduplicate:    config.Deduplicate,
+		DuplicateTag:   config.DuplicateTag,
+		MinFreeSpace:   config.MinFreeSpace,
+		Verify: job.VerifyOptions{
+			Enabled:  config.Verify,
+			Checksum: config.VerifyChecksum,
+			Retries:  config.VerifyRetries,
+		},
+		Hooks:          hooks.Runner{Hooks: config.Hooks, Timeout: config.HookTimeout},
+		DownloadWindow: config.DownloadWindow,
+	}
+}
+
+func getStatusTags(config configuration.Configuration) map[job.Outcome]string {
+	statusTags := map[job.Outcome]string{
+		job.OutcomeArchived:    config.ArchivedTag,
+		job.OutcomeSkipped:     config.SkippedTag,
+		job.OutcomeUnsupported: config.UnsupportedTag,
+		job.OutcomeFailed:      config.FailedTag,
+	}
+
+	maps.DeleteFunc(statusTags, func(_ job.Outcome, tag string) bool { return tag == "" })
+	return statusTags
+}
+
+func getLimits(config configuration.Configuration) ytdlp.Limits {
+	return ytdlp.Limits{
+		MaxDuration:      config.MaxDuration,
+		MaxFilesize:      config.MaxFilesize,
+		MaxTotalFilesize: config.MaxTotalFilesize,
+		MaxEntries:       config.MaxEntries,
+	}
+}
+
+func getProfileTags(config configuration.Configuration) []job.ProfileTag {
+	profileTags := make([]job.ProfileTag, len(config.ProfileTags))
+
+	for i, profileTag := range config.ProfileTags {
+		profileTags[i] = job.ProfileTag{Tag: profileTag.Tag, Profile: profileTag.Profile}
+	}
+
+	return profileTags
+}
+
+func getExtractorFilter(config configuration.Configuration) ytdlp.ExtractorFilter {
+	return ytdlp.ExtractorFilter{Allow: config.ExtractorsAllow, Deny: config.ExtractorsDeny}
+}
+
+// Connects to every target up front, so a misconfigured one stops the program before anything is processed
+func createTargets(ctx context.Context, config configuration.Configuration, tempdir string) []*target {
+	minVersion := semver.Semver{Major: 1, Minor: 44}
+	targets := make([]*target, 0, len(config.Targets))
+	var uploadLimiter *ratelimit.Limiter
+
+	// A single limiter is shared by all targets, since they share the same connection
+	if config.UploadRateLimit.IsSet() {
+		uploadLimiter = ratelimit.NewLimiter(config.UploadRateLimit)
+	}
+
+	for _, targetConfig := range config.Targets {
+		logger := slog.Default()
+		if targetConfig.Name != "" {
+			logger = logger.With("target", targetConfig.Name)
+		}
+
+		client := createLinkdingClient(targetConfig, logger)
+		client.UploadLimiter = uploadLimiter
+		checkLinkdingVersion(logging.WithContext(ctx, logger), client, minVersion)
+
+		targets = append(targets, &target{
+			name:     targetConfig.Name,
+			tags:     targetConfig.Tags,
+			bundleId: targetConfig.BundleId,
+			client:   client,
+			ytdlp:    createYtdlp(config, tempdir, targetConfig.Format),
+			store:    openStore(config, targetConfig.Name, logger),
+			logger:   logger,
+		})
+	}
+
+	return targets
+}
+
+func createLinkdingClient(targetConfig configuration.Target, logger *slog.Logger) *linkding.Client {
+	client, err := linkding.NewClient(targetConfig.BaseUrl, targetConfig.Token)
 
 	if err != nil {
-		log.Fatal(err)
+		fatal(logger, "Failed to create Linkding client", err)
 	}
 
 	return client
 }
 
-func checkLinkdingVersion(client *linkding.Client, minVersion semver.Semver) {
-	profile, err := client.GetUserProfile()
+func createYtdlp(config configuration.Configuration, tempdir string, format string) *ytdlp.Ytdlp {
+	ytdlp := ytdlp.NewYtdlp(tempdir, format)
+	ytdlp.Limits = getLimits(config)
+	ytdlp.Rules = config.Rules
+	ytdlp.RateLimit = config.DownloadRateLimit
+	ytdlp.RateLimitShare = config.DownloadWorkers
+
+	return ytdlp
+}
+
+func checkLinkdingVersion(ctx context.Context, client *linkding.Client, minVersion semver.Semver) {
+	logger := logging.FromContext(ctx)
+	profile, err := client.GetUserProfile(ctx)
 
 	if err != nil {
-		log.Fatal(err)
+		fatal(logger, "Failed to fetch Linkding user profile", err)
 	}
 
 	version, err := semver.Parse(profile.Version)
 
 	if err != nil {
-		log.Fatal(err)
+		fatal(logger, "Failed to parse Linkding version", err)
 	}
 
 	if semver.Compare(version, minVersion) == -1 {
-		log.Fatalf("Please upgrade Linkding: found version %s, but this program requires at least version %s", version, minVersion)
+		fatal(logger, "Please upgrade Linkding", fmt.Errorf("found version %s, but this program requires at least version %s", version, minVersion))
+	}
+}
+
+// Each target keeps its state in a directory of its own within the data directory
+func openStore(config configuration.Configuration, targetName string, logger *slog.Logger) *state.Store {
+	policy := state.RetryPolicy{
+		InitialDelay: config.RetryInitialDelay,
+		MaxDelay:     config.RetryMaxDelay,
+		MaxAttempts:  config.RetryMaxAttempts,
+	}
+	store, err := state.Open(filepath.Join(config.DataDir, targetName), policy)
+
+	if err != nil {
+		fatal(logger, "Failed to open state", err)
+	}
+
+	return store
+}
+
+func fatal(logger *slog.Logger, message string, err error) {
+	logger.Error(message, "error", err)
+	os.Exit(exitError)
+}
+
+func startServer(ctx context.Context, config configuration.Configuration, targets []*target, monitor *health.Monitor, triggers *trigger.Trigger) {
+	if config.HttpAddress == "" {
+		return
+	}
+
+	names := make([]string, len(targets))
+	checks := []health.Check{
+		func(ctx context.Context) error {
+			_, err := targets[0].ytdlp.Version(ctx)
+			return err
+		},
+	}
+
+	for i, target := range targets {
+		names[i] = target.name
+		checks = append(checks, func(ctx context.Context) error {
+			_, err := target.client.GetUserProfile(ctx)
+			return err
+		})
+	}
+
+	httpServer := server.New(config.HttpAddress)
+	httpServer.Handle("GET /metrics", metrics.Handler())
+	httpServer.Handle("GET /healthz", monitor.Handler())
+	httpServer.Handle("GET /readyz", health.Handler(checks...))
+
+	// Triggers start downloads, so anyone who can reach the address must not be able to use them
+	if config.HttpToken != "" {
+		httpServer.Handle("POST /scan", server.RequireToken(config.HttpToken, triggers.ScanHandler()))
+		httpServer.Handle("POST /bookmarks/{id}/archive", server.RequireToken(config.HttpToken, triggers.ArchiveHandler(names)))
+		httpServer.Handle("POST /targets/{target}/bookmarks/{id}/archive", server.RequireToken(config.HttpToken, triggers.ArchiveHandler(names)))
+	} else {
+		slog.Info("Endpoints that trigger runs are disabled, set LDMA_HTTP_TOKEN to enable them")
+	}
+
+	if err := httpServer.Start(ctx); err != nil {
+		log.Fatal(err)
 	}
 }
 
-func createTempDir() string {
-	tempdir, err := os.MkdirTemp(os.TempDir(), "media")
+// Checks the health endpoint of a running instance, for use as a container health check
+func runHealthcheck(config configuration.Configuration) int {
+	if config.HttpAddress == "" {
+		slog.Error("LDMA_HTTP_ADDRESS is required for the health check")
+		return exitError
+	}
+
+	host, port, err := net.SplitHostPort(config.HttpAddress)
+	if err != nil {
+		slog.Error("Invalid HTTP address", "address", config.HttpAddress, "error", err)
+		return exitError
+	}
+
+	if host == "" {
+		host = "localhost"
+	}
+
+	url := "http://" + net.JoinHostPort(host, port) + "/healthz"
+	if err := health.Probe(context.Background(), url); err != nil {
+		slog.Error("Health check failed", "error", err)
+		return exitError
+	}
+
+	return exitSuccess
+}
+
+// Shows the configuration after merging the configuration file, environment variables and defaults
+func runConfig(config configuration.Configuration, command string) int {
+	if command != "print" {
+		slog.Error("Unknown config command, expected print", "command", command)
+		return exitError
+	}
+
+	content, err := yaml.Marshal(config.Redacted())
+	if err != nil {
+		slog.Error("Failed to print configuration", "error", err)
+		return exitError
+	}
+
+	os.Stdout.Write(content)
+	return exitSuccess
+}
+
+// Leftovers are only removed from a configured work directory, as other instances may be using the system temp directory
+func createTempDir(workDir string) string {
+	if workDir == "" {
+		workDir = os.TempDir()
+	} else {
+		if err := os.MkdirAll(workDir, 0o755); err != nil {
+			log.Fatal(err)
+		}
+
+		disk.SweepTempDirs(workDir, tempDirPattern)
+	}
+
+	tempdir, err := os.MkdirTemp(workDir, tempDirPattern)
 
 	if err != nil {
 		log.Fatal(err)
@@ -117,12 +518,14 @@ func createTempDir() string {
 	return tempdir
 }
 
-func onInterrupt(cleanup func(int)) {
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+func onInterrupt() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	// Restore the default signal behavior so interrupting again exits immediately
+	context.AfterFunc(ctx, func() {
+		slog.Info("Shutting down, interrupt again to exit immediately")
+		stop()
+	})
 
-	go func() {
-		<-sigs
-		cleanup(1)
-	}()
+	return ctx
 }
@@ -1,57 +1,539 @@
 package configuration
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"linkding-media-archiver/internal/hooks"
+	"linkding-media-archiver/internal/logging"
+	"linkding-media-archiver/internal/ratelimit"
+	"linkding-media-archiver/internal/rules"
+	"linkding-media-archiver/internal/schedule"
+	"linkding-media-archiver/internal/ytdlp"
+	"maps"
+	"math"
+	"net"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 )
 
-func ReadConfiguration() Configuration {
-	return Configuration{
+// Unset variables fall back to their defaults, while invalid ones are collected into a single error listing every problem
+func ReadConfiguration() (Configuration, error) {
+	reader := &reader{}
+
+	config := Configuration{
 		LinkdingBaseUrl:       os.Getenv("LDMA_BASEURL"),
 		LinkdingToken:         os.Getenv("LDMA_TOKEN"),
-		BundleId:              getLinkdingBundleId(),
-		LogLevel:              os.Getenv("LDMA_LOG_LEVEL"),
-		ScanInterval:          getScanInterval(),
-		SkipExistingBookmarks: getSkipExistingBookmarks(),
-		Tags:                  getLinkdingTags(),
-		UpdateBookmarkText:    getUpdateBookmarkText(),
+		BundleId:              reader.getInt("LDMA_BUNDLE_ID", 0, 0),
+		LogLevel:              reader.getLogLevel(),
+		ScanInterval:          reader.getSeconds("LDMA_SCAN_INTERVAL", 3600, 1),
+		Schedule:              reader.getSchedule(),
+		DownloadWindow:        reader.getDownloadWindow(),
+		DownloadRateLimit:     reader.getRateLimit("LDMA_DOWNLOAD_RATE_LIMIT"),
+		UploadRateLimit:       reader.getRateLimit("LDMA_UPLOAD_RATE_LIMIT"),
+		ShutdownGracePeriod:   reader.getSeconds("LDMA_SHUTDOWN_GRACE_PERIOD", 30, 0),
+		SkipExistingBookmarks: reader.getBool("LDMA_SKIP_EXISTING_BOOKMARKS", false),
+		Tags:                  strings.Fields(os.Getenv("LDMA_TAGS")),
+		UpdateBookmarkText:    reader.getBool("LDMA_UPDATE_BOOKMARK_TEXT", false),
 		YtdlpFormat:           os.Getenv("LDMA_FORMAT"),
+		Rules:                 reader.getRules(),
+		Profiles:              reader.getProfiles(),
+		ProfileTags:           reader.getProfileTags(),
+		DefaultProfile:        os.Getenv("LDMA_DEFAULT_PROFILE"),
+		MaxDuration:           reader.getSeconds("LDMA_MAX_DURATION", 0, 0),
+		MaxFilesize:           reader.getSize("LDMA_MAX_FILESIZE"),
+		MaxTotalFilesize:      reader.getSize("LDMA_MAX_TOTAL_FILESIZE"),
+		MaxEntries:            reader.getInt("LDMA_MAX_ENTRIES", 0, 0),
+		Probe:                 reader.getBool("LDMA_PROBE", false),
+		SkipLive:              reader.getBool("LDMA_SKIP_LIVE", true),
+		SkipPlaylists:         reader.getBool("LDMA_SKIP_PLAYLISTS", false),
+		Deduplicate:           reader.getBool("LDMA_DEDUPLICATE", false),
+		DuplicateTag:          getStatusTag("LDMA_DUPLICATE_TAG"),
+		ExtractorsAllow:       strings.Fields(os.Getenv("LDMA_EXTRACTORS_ALLOW")),
+		ExtractorsDeny:        strings.Fields(os.Getenv("LDMA_EXTRACTORS_DENY")),
+		ArchivedTag:           getStatusTag("LDMA_ARCHIVED_TAG"),
+		SkippedTag:            getStatusTag("LDMA_SKIPPED_TAG"),
+		UnsupportedTag:        getStatusTag("LDMA_UNSUPPORTED_TAG"),
+		FailedTag:             getStatusTag("LDMA_FAILED_TAG"),
+		MediaTags:             reader.getBool("LDMA_MEDIA_TAGS", false),
+		MediaTagsAllow:        strings.Fields(os.Getenv("LDMA_MEDIA_TAGS_ALLOW")),
+		MediaTagsDeny:         strings.Fields(os.Getenv("LDMA_MEDIA_TAGS_DENY")),
+		MediaTagsPrefix:       os.Getenv("LDMA_MEDIA_TAGS_PREFIX"),
+		MediaTagsMax:          reader.getInt("LDMA_MEDIA_TAGS_MAX", 10, 0),
+		DownloadWorkers:       reader.getInt("LDMA_DOWNLOAD_WORKERS", 1, 1),
+		UploadWorkers:         reader.getInt("LDMA_UPLOAD_WORKERS", 2, 1),
+		DataDir:               getString("LDMA_DATA_DIR", "data"),
+		WorkDir:               getString("LDMA_WORK_DIR", ""),
+		MinFreeSpace:          reader.getSize("LDMA_MIN_FREE_SPACE"),
+		Verify:                reader.getBool("LDMA_VERIFY", false),
+		VerifyChecksum:        reader.getBool("LDMA_VERIFY_CHECKSUM", false),
+		VerifyRetries:         reader.getInt("LDMA_VERIFY_RETRIES", 1, 0),
+		Hooks:                 reader.getHooks(),
+		HookTimeout:           reader.getSeconds("LDMA_HOOK_TIMEOUT", 30, 1),
+		WebhookUrls:           reader.getUrls("LDMA_WEBHOOK_URLS"),
+		WebhookSecret:         os.Getenv("LDMA_WEBHOOK_SECRET"),
+		WebhookRetries:        reader.getInt("LDMA_WEBHOOK_RETRIES", 3, 0),
+		HttpAddress:           reader.getAddress("LDMA_HTTP_ADDRESS"),
+		HttpToken:             os.Getenv("LDMA_HTTP_TOKEN"),
+		HealthMaxIntervals:    reader.getInt("LDMA_HEALTH_MAX_INTERVALS", 3, 0),
+		HealthMaxStall:        reader.getSeconds("LDMA_HEALTH_MAX_STALL", 21600, 0),
+		ReportFile:            os.Getenv("LDMA_REPORT_FILE"),
+		RetryInitialDelay:     reader.getSeconds("LDMA_RETRY_DELAY", 3600, 1),
+		RetryMaxDelay:         reader.getSeconds("LDMA_RETRY_MAX_DELAY", 604800, 1),
+		RetryMaxAttempts:      reader.getInt("LDMA_RETRY_MAX_ATTEMPTS", 5, 0),
+	}
+
+	config.Targets = reader.getTargets(config)
+	reader.checkConflicts(config)
+
+	if len(reader.errs) > 0 {
+		return config, fmt.Errorf("invalid configuration:\n%w", errors.Join(reader.errs...))
+	}
+
+	return config, nil
+}
+
+func (reader *reader) add(key string, err error) {
+	reader.errs = append(reader.errs, fmt.Errorf("%s: %w", key, err))
+}
+
+// Settings that are valid on their own, but not in combination with others
+func (reader *reader) checkConflicts(config Configuration) {
+	if os.Getenv("LDMA_SCHEDULE") != "" && os.Getenv("LDMA_SCAN_INTERVAL") != "" {
+		reader.add("LDMA_SCHEDULE", errors.New("cannot be combined with LDMA_SCAN_INTERVAL"))
+	}
+
+	if config.RetryMaxDelay < config.RetryInitialDelay {
+		reader.add("LDMA_RETRY_MAX_DELAY", errors.New("must not be shorter than LDMA_RETRY_DELAY"))
+	}
+
+	if config.VerifyChecksum && !config.Verify {
+		reader.add("LDMA_VERIFY_CHECKSUM", errors.New("requires LDMA_VERIFY"))
+	}
+
+	if config.DuplicateTag != "" && !config.Deduplicate {
+		reader.add("LDMA_DUPLICATE_TAG", errors.New("requires LDMA_DEDUPLICATE"))
+	}
+
+	if config.HttpToken != "" && config.HttpAddress == "" {
+		reader.add("LDMA_HTTP_TOKEN", errors.New("requires LDMA_HTTP_ADDRESS"))
+	}
+
+	if _, ok := config.Profiles[config.DefaultProfile]; config.DefaultProfile != "" && !ok {
+		reader.add("LDMA_DEFAULT_PROFILE", fmt.Errorf("unknown profile %q", config.DefaultProfile))
+	}
+
+	for _, profileTag := range config.ProfileTags {
+		if _, ok := config.Profiles[profileTag.Profile]; !ok {
+			reader.add("LDMA_PROFILE_TAGS", fmt.Errorf("unknown profile %q", profileTag.Profile))
+		}
+	}
+
+	// A bookmark could never be told apart from one with a different outcome
+	statusTags := map[string]string{}
+
+	for _, key := range []string{"LDMA_ARCHIVED_TAG", "LDMA_SKIPPED_TAG", "LDMA_UNSUPPORTED_TAG", "LDMA_FAILED_TAG"} {
+		tag := getStatusTag(key)
+		if other, ok := statusTags[tag]; ok && tag != "" {
+			reader.add(key, fmt.Errorf("tag %q is already used by %s", tag, other))
+		}
+
+		statusTags[tag] = key
+	}
+}
+
+// Targets are named in LDMA_TARGETS and configured with LDMA_TARGET_<NAME>_* variables, falling back to a single unnamed target
+func (reader *reader) getTargets(config Configuration) []Target {
+	defaultTarget := Target{
+		BaseUrl:  config.LinkdingBaseUrl,
+		Token:    config.LinkdingToken,
+		Tags:     config.Tags,
+		BundleId: config.BundleId,
+		Format:   config.YtdlpFormat,
+	}
+
+	names := strings.Fields(strings.ReplaceAll(os.Getenv("LDMA_TARGETS"), ",", " "))
+
+	if len(names) == 0 {
+		reader.checkTarget("LDMA_", defaultTarget)
+		return []Target{defaultTarget}
+	}
+
+	var targets []Target
+
+	for _, name := range names {
+		switch {
+		case !isTargetName(name):
+			reader.add("LDMA_TARGETS", fmt.Errorf("invalid target name %q, use letters, digits and underscores", name))
+		// Names are case insensitive, as they end up in upper case in the names of their settings
+		case slices.ContainsFunc(targets, func(target Target) bool { return strings.EqualFold(target.Name, name) }):
+			reader.add("LDMA_TARGETS", fmt.Errorf("duplicate target name %q", name))
+		default:
+			targets = append(targets, reader.getTarget(name, defaultTarget))
+		}
+	}
+
+	for _, key := range []string{"LDMA_BASEURL", "LDMA_TOKEN"} {
+		if os.Getenv(key) != "" {
+			reader.add(key, errors.New("cannot be combined with LDMA_TARGETS, set it for each target instead"))
+		}
+	}
+
+	return targets
+}
+
+// Tags, bundle and format default to the ones set for all targets
+func (reader *reader) getTarget(name string, defaultTarget Target) Target {
+	prefix := "LDMA_TARGET_" + strings.ToUpper(name) + "_"
+	target := defaultTarget
+	target.Name = name
+	target.BaseUrl = os.Getenv(prefix + "BASEURL")
+	target.Token = os.Getenv(prefix + "TOKEN")
+	target.BundleId = reader.getInt(prefix+"BUNDLE_ID", defaultTarget.BundleId, 0)
+	target.Format = getString(prefix+"FORMAT", defaultTarget.Format)
+
+	if tags, ok := os.LookupEnv(prefix + "TAGS"); ok {
+		target.Tags = strings.Fields(tags)
+	}
+
+	reader.checkTarget(prefix, target)
+	return target
+}
+
+func (reader *reader) checkTarget(prefix string, target Target) {
+	if target.BaseUrl == "" {
+		reader.add(prefix+"BASEURL", errors.New("is required"))
+	} else if err := checkUrl(target.BaseUrl); err != nil {
+		reader.add(prefix+"BASEURL", err)
+	}
+
+	if target.Token == "" {
+		reader.add(prefix+"TOKEN", errors.New("is required"))
+	}
+}
+
+// Names end up in variable names and state directories, so they are limited to letters, digits and underscores
+func isTargetName(name string) bool {
+	for _, char := range name {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || char == '_') {
+			return false
+		}
+	}
+
+	return name != ""
+}
+
+func checkUrl(value string) error {
+	parsed, err := url.Parse(value)
+
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", value)
+	}
+
+	return nil
+}
+
+func (reader *reader) getUrls(key string) []string {
+	urls := strings.Fields(os.Getenv(key))
+
+	for _, value := range urls {
+		if err := checkUrl(value); err != nil {
+			reader.add(key, err)
+		}
+	}
+
+	return urls
+}
+
+func (reader *reader) getAddress(key string) string {
+	address := os.Getenv(key)
+
+	if _, _, err := net.SplitHostPort(address); address != "" && err != nil {
+		reader.add(key, fmt.Errorf("%q is not a host and port, such as :8080", address))
+	}
+
+	return address
+}
+
+func (reader *reader) getLogLevel() string {
+	level := os.Getenv("LDMA_LOG_LEVEL")
+
+	if _, err := logging.ParseLevel(level); err != nil {
+		reader.add("LDMA_LOG_LEVEL", err)
+	}
+
+	return level
+}
+
+func (reader *reader) getRules() rules.Rules {
+	parsed, err := rules.Parse(os.Getenv("LDMA_RULES"))
+
+	if err != nil {
+		reader.add("LDMA_RULES", err)
+	}
+
+	return parsed
+}
+
+func (reader *reader) getHooks() hooks.Hooks {
+	parsed, err := hooks.Parse(os.Getenv("LDMA_HOOKS"))
+
+	if err != nil {
+		reader.add("LDMA_HOOKS", err)
+	}
+
+	return parsed
+}
+
+func (reader *reader) getProfiles() map[string]ytdlp.Profile {
+	profiles := map[string]ytdlp.Profile{}
+	value := os.Getenv("LDMA_PROFILES")
+
+	if strings.TrimSpace(value) == "" {
+		return profiles
+	}
+
+	var parsed map[string]profile
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&parsed); err != nil {
+		reader.add("LDMA_PROFILES", err)
+		return profiles
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(parsed)) {
+		p := parsed[name]
+		maxFilesize, err := parseOptionalSize(p.MaxFilesize)
+		if err != nil {
+			reader.add("LDMA_PROFILES", fmt.Errorf("profile %s: maxFilesize: %w", name, err))
+		}
+
+		maxTotalFilesize, err := parseOptionalSize(p.MaxTotalFilesize)
+		if err != nil {
+			reader.add("LDMA_PROFILES", fmt.Errorf("profile %s: maxTotalFilesize: %w", name, err))
+		}
+
+		if p.MaxDuration < 0 || p.MaxEntries < 0 {
+			reader.add("LDMA_PROFILES", fmt.Errorf("profile %s: limits must not be negative", name))
+		}
+
+		profiles[name] = ytdlp.Profile{
+			Format:            p.Format,
+			ExtractAudio:      p.ExtractAudio,
+			AudioFormat:       p.AudioFormat,
+			EmbedSubtitles:    p.EmbedSubtitles,
+			SubtitleLanguages: p.SubtitleLanguages,
+			EmbedThumbnail:    p.EmbedThumbnail,
+			Limits: ytdlp.Limits{
+				MaxDuration:      time.Duration(p.MaxDuration) * time.Second,
+				MaxFilesize:      maxFilesize,
+				MaxTotalFilesize: maxTotalFilesize,
+				MaxEntries:       p.MaxEntries,
+			},
+		}
+	}
+
+	return profiles
+}
+
+// Parses space separated tag=profile pairs, in order of priority
+func (reader *reader) getProfileTags() []ProfileTag {
+	profileTags := make([]ProfileTag, 0)
+
+	for _, pair := range strings.Fields(os.Getenv("LDMA_PROFILE_TAGS")) {
+		tag, profileName, ok := strings.Cut(pair, "=")
+
+		if !ok || tag == "" || profileName == "" {
+			reader.add("LDMA_PROFILE_TAGS", fmt.Errorf("%q is not a tag=profile pair", pair))
+			continue
+		}
+
+		profileTags = append(profileTags, ProfileTag{Tag: strings.TrimPrefix(tag, "#"), Profile: profileName})
+	}
+
+	return profileTags
+}
+
+func (reader *reader) getSchedule() *schedule.Cron {
+	expression := os.Getenv("LDMA_SCHEDULE")
+
+	if expression == "" {
+		return nil
+	}
+
+	cron, err := schedule.ParseCron(expression)
+
+	if err != nil {
+		reader.add("LDMA_SCHEDULE", err)
+	}
+
+	return cron
+}
+
+func (reader *reader) getDownloadWindow() *schedule.Window {
+	value := os.Getenv("LDMA_DOWNLOAD_WINDOW")
+
+	if value == "" {
+		return nil
+	}
+
+	window, err := schedule.ParseWindow(value)
+
+	if err != nil {
+		reader.add("LDMA_DOWNLOAD_WINDOW", err)
+	}
+
+	return window
+}
+
+func (reader *reader) getRateLimit(key string) ratelimit.Schedule {
+	rates, err := parseRateLimit(os.Getenv(key))
+
+	if err != nil {
+		reader.add(key, err)
+	}
+
+	return rates
+}
+
+func getString(key string, fallback string) string {
+	value := os.Getenv(key)
+
+	if value == "" {
+		return fallback
 	}
+
+	return value
 }
 
-func getLinkdingTags() []string {
-	tagsEnv := os.Getenv("LDMA_TAGS")
-	return strings.Fields(tagsEnv)
+func getStatusTag(key string) string {
+	return strings.TrimPrefix(strings.TrimSpace(os.Getenv(key)), "#")
 }
 
-func getLinkdingBundleId() int {
-	bundleId, err := strconv.Atoi(os.Getenv("LDMA_BUNDLE_ID"))
+func (reader *reader) getInt(key string, fallback int, min int) int {
+	value := strings.TrimSpace(os.Getenv(key))
 
-	if bundleId <= 0 || err != nil {
-		bundleId = 0
+	if value == "" {
+		return fallback
 	}
 
-	return bundleId
+	number, err := strconv.Atoi(value)
+
+	if err != nil {
+		reader.add(key, fmt.Errorf("%q is not a whole number", value))
+		return fallback
+	}
+
+	if number < min {
+		reader.add(key, fmt.Errorf("must be at least %d, got %d", min, number))
+		return fallback
+	}
+
+	return number
 }
 
-func getScanInterval() time.Duration {
-	interval, err := strconv.Atoi(os.Getenv("LDMA_SCAN_INTERVAL"))
+func (reader *reader) getSeconds(key string, fallback int, min int) time.Duration {
+	return time.Duration(reader.getInt(key, fallback, min)) * time.Second
+}
 
-	if interval <= 0 || err != nil {
-		interval = 3600
+func (reader *reader) getBool(key string, fallback bool) bool {
+	value := strings.TrimSpace(os.Getenv(key))
+
+	if value == "" {
+		return fallback
 	}
 
-	return time.Duration(interval) * time.Second
+	parsed, err := strconv.ParseBool(value)
+
+	if err != nil {
+		reader.add(key, fmt.Errorf("%q is not true or false", value))
+		return fallback
+	}
+
+	return parsed
 }
 
-func getUpdateBookmarkText() bool {
-	update, err := strconv.ParseBool(os.Getenv("LDMA_UPDATE_BOOKMARK_TEXT"))
-	return err == nil && update
+func (reader *reader) getSize(key string) int64 {
+	size, err := parseOptionalSize(os.Getenv(key))
+
+	if err != nil {
+		reader.add(key, err)
+	}
+
+	return size
 }
 
-func getSkipExistingBookmarks() bool {
-	skip, err := strconv.ParseBool(os.Getenv("LDMA_SKIP_EXISTING_BOOKMARKS"))
-	return err == nil && skip
+// Parses a default rate and rates for windows of the day, such as "1M 01:00-06:00=10M" (0 for unlimited)
+func parseRateLimit(value string) (ratelimit.Schedule, error) {
+	var rates ratelimit.Schedule
+
+	for part := range strings.FieldsSeq(value) {
+		windowPart, ratePart, hasWindow := strings.Cut(part, "=")
+
+		if !hasWindow {
+			rate, err := parseSize(part)
+			if err != nil || rate < 0 {
+				return ratelimit.Schedule{}, fmt.Errorf("invalid rate %q", part)
+			}
+
+			rates.Default = rate
+			continue
+		}
+
+		window, err := schedule.ParseWindow(windowPart)
+		if err != nil {
+			return ratelimit.Schedule{}, err
+		}
+
+		rate, err := parseSize(ratePart)
+		if err != nil || rate < 0 {
+			return ratelimit.Schedule{}, fmt.Errorf("invalid rate %q", ratePart)
+		}
+
+		rates.Windows = append(rates.Windows, ratelimit.WindowRate{Window: window, Rate: rate})
+	}
+
+	return rates, nil
+}
+
+// Empty sizes mean no limit
+func parseOptionalSize(value string) (int64, error) {
+	if strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+
+	size, err := parseSize(value)
+
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("%q is not a size, such as 500K, 1.5M or 2G", value)
+	}
+
+	return size, nil
+}
+
+// Parses a number of bytes with an optional binary suffix, such as 500K, 1.5M or 2G
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := 1.0
+
+	for i, suffix := range []string{"K", "M", "G", "T"} {
+		if trimmed, ok := strings.CutSuffix(value, suffix); ok {
+			value = trimmed
+			multiplier = math.Pow(1024, float64(i+1))
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(number * multiplier), nil
 }
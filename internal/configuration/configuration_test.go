@@ -0,0 +1,145 @@
+package configuration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int64
+	}{
+		{"1000", 1000},
+		{"500K", 500 * 1024},
+		{"1.5m", 1536 * 1024},
+		{" 2G ", 2 * 1024 * 1024 * 1024},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			actual, err := parseSize(test.value)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual != test.expected {
+				t.Errorf("Expected %s to be parsed as %d, got %d", test.value, test.expected, actual)
+			}
+		})
+	}
+
+	if _, err := parseSize("lots"); err == nil {
+		t.Error("Expected invalid size to fail")
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	rates, err := parseRateLimit("1M 01:00-06:00=0 18:00-23:00=512K")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rates.Default != 1024*1024 || len(rates.Windows) != 2 || rates.Windows[0].Rate != 0 || rates.Windows[1].Rate != 512*1024 {
+		t.Errorf("Unexpected rates %+v", rates)
+	}
+
+	if rates.Windows[1].Window.String() != "18:00-23:00" {
+		t.Errorf("Unexpected window %s", rates.Windows[1].Window)
+	}
+
+	for _, value := range []string{"fast", "01:00-06:00", "01:00=1M", "01:00-06:00=fast"} {
+		if _, err := parseRateLimit(value); err == nil {
+			t.Errorf("Expected %q to fail", value)
+		}
+	}
+}
+
+func TestGetTargets(t *testing.T) {
+	defaults := Configuration{LinkdingBaseUrl: "https://default", LinkdingToken: "secret", Tags: []string{"video"}, BundleId: 3, YtdlpFormat: "best"}
+	reader := &reader{}
+
+	if targets := reader.getTargets(defaults); len(targets) != 1 || targets[0].Name != "" || targets[0].BaseUrl != "https://default" || len(reader.errs) > 0 {
+		t.Errorf("Expected a single unnamed target, got %+v and errors %v", targets, reader.errs)
+	}
+
+	t.Setenv("LDMA_TARGETS", "personal, team")
+	t.Setenv("LDMA_TARGET_PERSONAL_BASEURL", "https://personal")
+	t.Setenv("LDMA_TARGET_PERSONAL_TOKEN", "secret")
+	t.Setenv("LDMA_TARGET_TEAM_BASEURL", "https://team")
+	t.Setenv("LDMA_TARGET_TEAM_TOKEN", "secret")
+	t.Setenv("LDMA_TARGET_TEAM_TAGS", "")
+	t.Setenv("LDMA_TARGET_TEAM_BUNDLE_ID", "7")
+	t.Setenv("LDMA_TARGET_TEAM_FORMAT", "worst")
+
+	targets := reader.getTargets(Configuration{Tags: []string{"video"}, BundleId: 3, YtdlpFormat: "best"})
+	expected := []Target{
+		{Name: "personal", BaseUrl: "https://personal", Token: "secret", Tags: []string{"video"}, BundleId: 3, Format: "best"},
+		{Name: "team", BaseUrl: "https://team", Token: "secret", Tags: []string{}, BundleId: 7, Format: "worst"},
+	}
+
+	if !reflect.DeepEqual(targets, expected) || len(reader.errs) > 0 {
+		t.Errorf("Expected targets %+v, got %+v and errors %v", expected, targets, reader.errs)
+	}
+
+	t.Setenv("LDMA_TARGETS", "personal,invalid-name,PERSONAL")
+	t.Setenv("LDMA_BASEURL", "https://default")
+	reader.getTargets(Configuration{})
+
+	if len(reader.errs) != 3 {
+		t.Errorf("Expected errors for the invalid name, the name differing only in case and LDMA_BASEURL, got %v", reader.errs)
+	}
+}
+
+func TestReadConfiguration(t *testing.T) {
+	t.Setenv("LDMA_BASEURL", "https://linkding.example.com")
+	t.Setenv("LDMA_TOKEN", "secret")
+
+	config, err := ReadConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ScanInterval != time.Hour || !config.SkipLive || config.UploadWorkers != 2 {
+		t.Errorf("Expected defaults, got %+v", config)
+	}
+
+	invalid := map[string]string{
+		"LDMA_BASEURL":         "linkding.example.com",
+		"LDMA_BUNDLE_ID":       "abc",
+		"LDMA_LOG_LEVEL":       "VERBOSE",
+		"LDMA_SCAN_INTERVAL":   "0",
+		"LDMA_PROBE":           "maybe",
+		"LDMA_MAX_FILESIZE":    "1X",
+		"LDMA_SCHEDULE":        "* * *",
+		"LDMA_RULES":           "{",
+		"LDMA_VERIFY_CHECKSUM": "true",
+		"LDMA_WEBHOOK_URLS":    "ftp://example.com",
+		"LDMA_FAILED_TAG":      "#done",
+	}
+
+	for key, value := range invalid {
+		t.Setenv(key, value)
+	}
+
+	t.Setenv("LDMA_ARCHIVED_TAG", "done")
+
+	_, err = ReadConfiguration()
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	// Every problem is reported, along with the conflict between the schedule and the scan interval
+	for key := range invalid {
+		if !strings.Contains(err.Error(), key+":") {
+			t.Errorf("Expected an error for %s, got %v", key, err)
+		}
+	}
+
+	if !strings.Contains(err.Error(), "LDMA_SCHEDULE: cannot be combined with LDMA_SCAN_INTERVAL") {
+		t.Errorf("Expected a conflict between LDMA_SCHEDULE and LDMA_SCAN_INTERVAL, got %v", err)
+	}
+}
@@ -0,0 +1,429 @@
+package configuration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"linkding-media-archiver/internal/hooks"
+	"linkding-media-archiver/internal/ratelimit"
+	"linkding-media-archiver/internal/rules"
+	"linkding-media-archiver/internal/schedule"
+	"linkding-media-archiver/internal/ytdlp"
+	"maps"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "REDACTED"
+
+// Sets the environment variables for the settings in a YAML file, unless they are already set, like a .env file.
+// Settings are named like the environment variables without the LDMA_ prefix in lowercase.
+// Reads the configuration file, if any, and the environment, reporting the problems of both at once
+func Load(path string) (Configuration, error) {
+	var fileErr error
+	if path != "" {
+		fileErr = LoadFile(path)
+	}
+
+	config, err := ReadConfiguration()
+	return config, errors.Join(fileErr, err)
+}
+
+// Sets the environment variables for the settings in the file that aren't set already.
+// Valid settings are applied even when others are not, so their problems can be reported along with the rest.
+func LoadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var settings map[string]yaml.Node
+	if err := yaml.Unmarshal(content, &settings); err != nil {
+		return fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+
+	variables, err := fileVariables(settings)
+
+	for key, value := range variables {
+		if _, ok := os.LookupEnv(key); !ok {
+			os.Setenv(key, value)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid configuration file %s:\n%w", path, err)
+	}
+
+	return nil
+}
+
+// Writes the settings the way LoadFile reads them, so a printed configuration can be loaded again
+func (config Configuration) MarshalYAML() (any, error) {
+	return settingsNode(config, config.setting)
+}
+
+// Builds a mapping in the order of the struct fields, with the settings the given function keeps
+func settingsNode(settings any, setting func(name string, value any) (any, bool)) (*yaml.Node, error) {
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+	value := reflect.ValueOf(settings)
+
+	for i := range value.NumField() {
+		name := value.Type().Field(i).Tag.Get("yaml")
+		converted, ok := setting(name, value.Field(i).Interface())
+		if !ok {
+			continue
+		}
+
+		var node yaml.Node
+		if err := node.Encode(converted); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, &node)
+	}
+
+	return mapping, nil
+}
+
+// Converts a setting back to the format of its environment variable, leaving out unset and conflicting settings
+func (config Configuration) setting(name string, value any) (any, bool) {
+	hasTargets := slices.ContainsFunc(config.Targets, func(target Target) bool { return target.Name != "" })
+
+	switch {
+	case name == "targets" && !hasTargets:
+		return nil, false
+	case (name == "baseurl" || name == "token") && hasTargets:
+		return nil, false
+	case name == "scan_interval" && config.Schedule != nil:
+		return nil, false
+	}
+
+	switch value := value.(type) {
+	case string:
+		return value, value != ""
+	case []string:
+		return value, len(value) > 0
+	case []Target:
+		targets := make([]*yaml.Node, len(value))
+		for i, target := range value {
+			targets[i], _ = settingsNode(target, config.targetSetting)
+		}
+
+		return targets, true
+	case time.Duration:
+		return int64(value / time.Second), true
+	case int64:
+		// Sizes without a unit are written as numbers
+		if size := formatSize(value); size != strconv.FormatInt(value, 10) {
+			return size, true
+		}
+
+		return value, true
+	case *schedule.Cron:
+		if value == nil {
+			return nil, false
+		}
+
+		return value.String(), true
+	case *schedule.Window:
+		if value == nil {
+			return nil, false
+		}
+
+		return value.String(), true
+	case ratelimit.Schedule:
+		return formatRateLimit(value), value.Default != 0 || len(value.Windows) > 0
+	case map[string]ytdlp.Profile:
+		return fromJson(formatProfiles(value)), len(value) > 0
+	case []ProfileTag:
+		pairs := make([]string, len(value))
+		for i, profileTag := range value {
+			pairs[i] = profileTag.Tag + "=" + profileTag.Profile
+		}
+
+		return pairs, len(pairs) > 0
+	case rules.Rules:
+		return fromJson(value), len(value) > 0
+	case hooks.Hooks:
+		return fromJson(value), len(value) > 0
+	}
+
+	return value, true
+}
+
+// Leaves out the tags, bundle and format a target inherits from the settings for all targets
+func (config Configuration) targetSetting(name string, value any) (any, bool) {
+	switch name {
+	case "tags":
+		return value, !slices.Equal(value.([]string), config.Tags)
+	case "bundle_id":
+		return value, value != config.BundleId
+	case "format":
+		return value, value != config.YtdlpFormat
+	}
+
+	return value, value != ""
+}
+
+// Uses the largest unit the size is a whole multiple of, so it is read back exactly
+func formatSize(size int64) string {
+	for _, unit := range []string{"T", "G", "M", "K"} {
+		multiple := int64(1) << (10 * (strings.Index("KMGT", unit) + 1))
+
+		if size != 0 && size%multiple == 0 {
+			return strconv.FormatInt(size/multiple, 10) + unit
+		}
+	}
+
+	return strconv.FormatInt(size, 10)
+}
+
+// Empty sizes mean no limit
+func formatOptionalSize(size int64) string {
+	if size == 0 {
+		return ""
+	}
+
+	return formatSize(size)
+}
+
+func formatRateLimit(rates ratelimit.Schedule) string {
+	var parts []string
+
+	if rates.Default != 0 || len(rates.Windows) == 0 {
+		parts = append(parts, formatSize(rates.Default))
+	}
+
+	for _, windowRate := range rates.Windows {
+		parts = append(parts, windowRate.Window.String()+"="+formatSize(windowRate.Rate))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func formatProfiles(profiles map[string]ytdlp.Profile) map[string]profile {
+	formatted := make(map[string]profile, len(profiles))
+
+	for name, p := range profiles {
+		formatted[name] = profile{
+			Format:            p.Format,
+			ExtractAudio:      p.ExtractAudio,
+			AudioFormat:       p.AudioFormat,
+			EmbedSubtitles:    p.EmbedSubtitles,
+			SubtitleLanguages: p.SubtitleLanguages,
+			EmbedThumbnail:    p.EmbedThumbnail,
+			MaxDuration:       int(p.Limits.MaxDuration / time.Second),
+			MaxFilesize:       formatOptionalSize(p.Limits.MaxFilesize),
+			MaxTotalFilesize:  formatOptionalSize(p.Limits.MaxTotalFilesize),
+			MaxEntries:        p.Limits.MaxEntries,
+		}
+	}
+
+	return formatted
+}
+
+// Rules, hooks and profiles are written in the shape of their JSON, which the YAML encoder doesn't know about
+func fromJson(value any) any {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+
+	var decoded any
+	json.Unmarshal(content, &decoded)
+	return decoded
+}
+
+// Returns the configuration with tokens and secrets replaced, so it can be shown
+func (config Configuration) Redacted() Configuration {
+	redact(&config.LinkdingToken)
+	redact(&config.WebhookSecret)
+	redact(&config.HttpToken)
+
+	config.Targets = slices.Clone(config.Targets)
+	for i := range config.Targets {
+		redact(&config.Targets[i].Token)
+	}
+
+	config.WebhookUrls = slices.Clone(config.WebhookUrls)
+	for i := range config.WebhookUrls {
+		config.WebhookUrls[i] = redactUrl(config.WebhookUrls[i])
+	}
+
+	return config
+}
+
+func redact(secret *string) {
+	if *secret != "" {
+		*secret = redacted
+	}
+}
+
+// Webhook URLs carry their secrets anywhere from the user info to the path, such as for Slack and Discord, so only the scheme and host are kept
+func redactUrl(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Host == "" {
+		return redacted
+	}
+
+	redactedUrl := url.URL{Scheme: parsed.Scheme, Host: parsed.Host}
+
+	if parsed.User != nil || strings.Trim(parsed.Path, "/") != "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+		redactedUrl.Path = "/" + redacted
+	}
+
+	return redactedUrl.String()
+}
+
+// Converts the settings of a configuration file to the environment variables they stand for
+func fileVariables(settings map[string]yaml.Node) (map[string]string, error) {
+	variables := map[string]string{}
+	known := settingTypes(reflect.TypeFor[Configuration]())
+	var errs []error
+
+	for _, name := range slices.Sorted(maps.Keys(settings)) {
+		settingType, ok := known[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown setting %q", name))
+			continue
+		}
+
+		if name == "targets" {
+			errs = append(errs, targetVariables(settings[name], variables))
+			continue
+		}
+
+		variable, err := variableValue(settings[name], settingType)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		variables["LDMA_"+strings.ToUpper(name)] = variable
+	}
+
+	return variables, errors.Join(errs...)
+}
+
+func targetVariables(node yaml.Node, variables map[string]string) error {
+	var targets []map[string]yaml.Node
+	if err := node.Decode(&targets); err != nil {
+		return fmt.Errorf("targets: expected a list of targets: %w", err)
+	}
+
+	known := settingTypes(reflect.TypeFor[Target]())
+	var names []string
+	var errs []error
+
+	for i, target := range targets {
+		var name string
+		nameNode, ok := target["name"]
+
+		if !ok || nameNode.Decode(&name) != nil || !isTargetName(name) || slices.ContainsFunc(names, func(other string) bool { return strings.EqualFold(other, name) }) {
+			errs = append(errs, fmt.Errorf("targets: invalid or duplicate name for target %d", i+1))
+			continue
+		}
+
+		names = append(names, name)
+		prefix := "LDMA_TARGET_" + strings.ToUpper(name) + "_"
+
+		for _, setting := range slices.Sorted(maps.Keys(target)) {
+			settingType, ok := known[setting]
+			if !ok {
+				errs = append(errs, fmt.Errorf("targets: unknown setting %q for target %s", setting, name))
+				continue
+			}
+
+			if setting == "name" {
+				continue
+			}
+
+			variable, err := variableValue(target[setting], settingType)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("targets: %s: %s: %w", name, setting, err))
+				continue
+			}
+
+			variables[prefix+strings.ToUpper(setting)] = variable
+		}
+	}
+
+	if len(names) > 0 {
+		variables["LDMA_TARGETS"] = strings.Join(names, ",")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Booleans are decoded as such, so YAML 1.1 values like yes and off work too.
+// Lists of plain values are separated by spaces, and anything more complex is passed on as JSON.
+func variableValue(node yaml.Node, settingType reflect.Type) (string, error) {
+	if settingType.Kind() == reflect.Bool {
+		var value bool
+		if err := node.Decode(&value); err != nil {
+			return "", err
+		}
+
+		return strconv.FormatBool(value), nil
+	}
+
+	var value any
+	if err := node.Decode(&value); err != nil {
+		return "", err
+	}
+
+	return formatValue(value)
+}
+
+func formatValue(value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case []any:
+		items := make([]string, len(value))
+
+		for i, item := range value {
+			switch item.(type) {
+			case []any, map[string]any:
+				return toJson(value)
+			}
+
+			items[i], _ = formatValue(item)
+		}
+
+		return strings.Join(items, " "), nil
+	default:
+		return toJson(value)
+	}
+}
+
+func toJson(value any) (string, error) {
+	content, err := json.Marshal(value)
+	return string(content), err
+}
+
+func settingTypes(structType reflect.Type) map[string]reflect.Type {
+	types := map[string]reflect.Type{}
+
+	for i := range structType.NumField() {
+		field := structType.Field(i)
+		types[field.Tag.Get("yaml")] = field.Type
+	}
+
+	return types
+}
@@ -1,15 +1,106 @@
 package configuration
 
-import "time"
+import (
+	"linkding-media-archiver/internal/hooks"
+	"linkding-media-archiver/internal/ratelimit"
+	"linkding-media-archiver/internal/rules"
+	"linkding-media-archiver/internal/schedule"
+	"linkding-media-archiver/internal/ytdlp"
+	"time"
+)
 
 type Configuration struct {
-	LinkdingBaseUrl       string
-	LinkdingToken         string
-	BundleId              int
-	LogLevel              string
-	ScanInterval          time.Duration
-	SkipExistingBookmarks bool
-	Tags                  []string
-	UpdateBookmarkText    bool
-	YtdlpFormat           string
+	LinkdingBaseUrl       string                   `yaml:"baseurl"`
+	LinkdingToken         string                   `yaml:"token"`
+	Targets               []Target                 `yaml:"targets"`
+	BundleId              int                      `yaml:"bundle_id"`
+	LogLevel              string                   `yaml:"log_level"`
+	ScanInterval          time.Duration            `yaml:"scan_interval"`
+	Schedule              *schedule.Cron           `yaml:"schedule"`
+	DownloadWindow        *schedule.Window         `yaml:"download_window"`
+	DownloadRateLimit     ratelimit.Schedule       `yaml:"download_rate_limit"`
+	UploadRateLimit       ratelimit.Schedule       `yaml:"upload_rate_limit"`
+	ShutdownGracePeriod   time.Duration            `yaml:"shutdown_grace_period"`
+	SkipExistingBookmarks bool                     `yaml:"skip_existing_bookmarks"`
+	Tags                  []string                 `yaml:"tags"`
+	UpdateBookmarkText    bool                     `yaml:"update_bookmark_text"`
+	YtdlpFormat           string                   `yaml:"format"`
+	Rules                 rules.Rules              `yaml:"rules"`
+	Profiles              map[string]ytdlp.Profile `yaml:"profiles"`
+	ProfileTags           []ProfileTag             `yaml:"profile_tags"`
+	DefaultProfile        string                   `yaml:"default_profile"`
+	MaxDuration           time.Duration            `yaml:"max_duration"`
+	MaxFilesize           int64                    `yaml:"max_filesize"`
+	MaxTotalFilesize      int64                    `yaml:"max_total_filesize"`
+	MaxEntries            int                      `yaml:"max_entries"`
+	Probe                 bool                     `yaml:"probe"`
+	SkipLive              bool                     `yaml:"skip_live"`
+	SkipPlaylists         bool                     `yaml:"skip_playlists"`
+	Deduplicate           bool                     `yaml:"deduplicate"`
+	DuplicateTag          string                   `yaml:"duplicate_tag"`
+	ExtractorsAllow       []string                 `yaml:"extractors_allow"`
+	ExtractorsDeny        []string                 `yaml:"extractors_deny"`
+	ArchivedTag           string                   `yaml:"archived_tag"`
+	SkippedTag            string                   `yaml:"skipped_tag"`
+	UnsupportedTag        string                   `yaml:"unsupported_tag"`
+	FailedTag             string                   `yaml:"failed_tag"`
+	MediaTags             bool                     `yaml:"media_tags"`
+	MediaTagsAllow        []string                 `yaml:"media_tags_allow"`
+	MediaTagsDeny         []string                 `yaml:"media_tags_deny"`
+	MediaTagsPrefix       string                   `yaml:"media_tags_prefix"`
+	MediaTagsMax          int                      `yaml:"media_tags_max"`
+	DownloadWorkers       int                      `yaml:"download_workers"`
+	UploadWorkers         int                      `yaml:"upload_workers"`
+	DataDir               string                   `yaml:"data_dir"`
+	WorkDir               string                   `yaml:"work_dir"`
+	MinFreeSpace          int64                    `yaml:"min_free_space"`
+	Verify                bool                     `yaml:"verify"`
+	VerifyChecksum        bool                     `yaml:"verify_checksum"`
+	VerifyRetries         int                      `yaml:"verify_retries"`
+	Hooks                 hooks.Hooks              `yaml:"hooks"`
+	HookTimeout           time.Duration            `yaml:"hook_timeout"`
+	WebhookUrls           []string                 `yaml:"webhook_urls"`
+	WebhookSecret         string                   `yaml:"webhook_secret"`
+	WebhookRetries        int                      `yaml:"webhook_retries"`
+	HttpAddress           string                   `yaml:"http_address"`
+	HttpToken             string                   `yaml:"http_token"`
+	HealthMaxIntervals    int                      `yaml:"health_max_intervals"`
+	HealthMaxStall        time.Duration            `yaml:"health_max_stall"`
+	ReportFile            string                   `yaml:"report_file"`
+	RetryInitialDelay     time.Duration            `yaml:"retry_delay"`
+	RetryMaxDelay         time.Duration            `yaml:"retry_max_delay"`
+	RetryMaxAttempts      int                      `yaml:"retry_max_attempts"`
+}
+
+// A Linkding instance or account to archive media for, with its own state
+type Target struct {
+	Name     string   `yaml:"name"`
+	BaseUrl  string   `yaml:"baseurl"`
+	Token    string   `yaml:"token"`
+	Tags     []string `yaml:"tags"`
+	BundleId int      `yaml:"bundle_id"`
+	Format   string   `yaml:"format"`
+}
+
+type ProfileTag struct {
+	Tag     string
+	Profile string
+}
+
+type profile struct {
+	Format            string   `json:"format,omitempty"`
+	ExtractAudio      bool     `json:"extractAudio,omitempty"`
+	AudioFormat       string   `json:"audioFormat,omitempty"`
+	EmbedSubtitles    bool     `json:"embedSubtitles,omitempty"`
+	SubtitleLanguages []string `json:"subtitleLanguages,omitempty"`
+	EmbedThumbnail    bool     `json:"embedThumbnail,omitempty"`
+	MaxDuration       int      `json:"maxDuration,omitempty"`
+	MaxFilesize       string   `json:"maxFilesize,omitempty"`
+	MaxTotalFilesize  string   `json:"maxTotalFilesize,omitempty"`
+	MaxEntries        int      `json:"maxEntries,omitempty"`
+}
+
+// Collects the problems found while reading the configuration
+type reader struct {
+	errs []error
 }
@@ -0,0 +1,33 @@
+package disk
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrUnsupported = errors.New("free disk space can't be determined on this platform")
+
+// Removes directories created with os.MkdirTemp(dir, pattern) that were left behind by runs that didn't exit cleanly
+func SweepTempDirs(dir string, pattern string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Warn("Failed to list work directory for leftovers", "dir", dir, "error", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), pattern) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		slog.Info("Removing leftover work directory", "path", path)
+
+		if err := os.RemoveAll(path); err != nil {
+			slog.Warn("Failed to remove leftover work directory", "path", path, "error", err)
+		}
+	}
+}
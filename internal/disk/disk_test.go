@@ -0,0 +1,51 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSweepTempDirs(t *testing.T) {
+	dir := t.TempDir()
+
+	leftover, err := os.MkdirTemp(dir, "linkding-media-archiver-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(leftover, "video.mp4.part"), []byte("video"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	unrelated := filepath.Join(dir, "unrelated")
+	if err := os.Mkdir(unrelated, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	SweepTempDirs(dir, "linkding-media-archiver-")
+
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Error("Expected leftover directory to be removed")
+	}
+
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Error("Expected unrelated directory to be kept")
+	}
+}
+
+func TestFreeSpace(t *testing.T) {
+	free, err := FreeSpace(t.TempDir())
+
+	if err == ErrUnsupported {
+		t.Skip(err)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if free == 0 {
+		t.Error("Expected some free space in the temp directory")
+	}
+}
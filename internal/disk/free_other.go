@@ -0,0 +1,7 @@
+//go:build !(linux || darwin || freebsd)
+
+package disk
+
+func FreeSpace(path string) (uint64, error) {
+	return 0, ErrUnsupported
+}
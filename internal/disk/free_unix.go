@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd
+
+package disk
+
+import "syscall"
+
+// Returns the number of bytes available to unprivileged users on the file system containing path
+func FreeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
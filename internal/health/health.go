@@ -0,0 +1,140 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const checkTimeout = 10 * time.Second
+
+func NewMonitor(maxAge time.Duration, maxStall time.Duration, now time.Time) *Monitor {
+	return &Monitor{MaxAge: maxAge, MaxStall: maxStall, startedAt: now, lastTick: now}
+}
+
+// Called when the scan loop starts a run
+func (monitor *Monitor) RunStarted(now time.Time) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	monitor.lastTick, monitor.lastProgress, monitor.isRunning = now, now, true
+}
+
+// Called when a run made progress, or with a time in the future when it is expected to wait until then
+func (monitor *Monitor) Progress(at time.Time) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	if at.After(monitor.lastProgress) {
+		monitor.lastProgress = at
+	}
+}
+
+// Called when the scan loop finished a run, or skipped it
+func (monitor *Monitor) RunFinished(now time.Time, isSuccess bool) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	monitor.lastTick, monitor.isRunning = now, false
+
+	if isSuccess {
+		monitor.lastScan = now
+	}
+}
+
+// The loop is unhealthy if it hasn't ticked or scanned successfully within the maximum age, or a run has stalled
+func (monitor *Monitor) Check(now time.Time) error {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	// Long runs are healthy for as long as they make progress
+	if monitor.isRunning {
+		if monitor.MaxStall > 0 && now.Sub(monitor.lastProgress) > monitor.MaxStall {
+			return fmt.Errorf("run has made no progress since %s", monitor.lastProgress.Format(time.RFC3339))
+		}
+
+		return nil
+	}
+
+	if monitor.MaxAge <= 0 {
+		return nil
+	}
+
+	if now.Sub(monitor.lastTick) > monitor.MaxAge {
+		return fmt.Errorf("scan loop last ticked at %s", monitor.lastTick.Format(time.RFC3339))
+	}
+
+	lastScan := monitor.lastScan
+	if lastScan.IsZero() {
+		lastScan = monitor.startedAt
+	}
+
+	if now.Sub(lastScan) > monitor.MaxAge {
+		if monitor.lastScan.IsZero() {
+			return fmt.Errorf("no successful scan since starting at %s", lastScan.Format(time.RFC3339))
+		}
+
+		return fmt.Errorf("last successful scan was at %s", lastScan.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+func (monitor *Monitor) Handler() http.Handler {
+	return Handler(func(ctx context.Context) error {
+		return monitor.Check(time.Now())
+	})
+}
+
+// Responds with 200 if all checks pass, or 503 with the errors otherwise
+func Handler(checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		var errs []error
+		for _, check := range checks {
+			errs = append(errs, check(ctx))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := errors.Join(errs...); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(status{Status: "error", Error: err.Error()})
+			return
+		}
+
+		json.NewEncoder(w).Encode(status{Status: "ok"})
+	})
+}
+
+// Requests the endpoint and returns an error unless it responds with a success status code
+func Probe(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	var body status
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded with %s: %s", url, resp.Status, body.Error)
+	}
+
+	return nil
+}
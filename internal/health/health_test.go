@@ -0,0 +1,76 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMonitorCheck(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	monitor := NewMonitor(3*time.Hour, time.Hour, start)
+
+	if err := monitor.Check(start.Add(time.Hour)); err != nil {
+		t.Errorf("Expected healthy monitor shortly after starting, got %v", err)
+	}
+
+	if err := monitor.Check(start.Add(4 * time.Hour)); err == nil {
+		t.Error("Expected unhealthy monitor without any ticks")
+	}
+
+	monitor.RunStarted(start.Add(time.Hour))
+	monitor.RunFinished(start.Add(2*time.Hour), true)
+
+	if err := monitor.Check(start.Add(4 * time.Hour)); err != nil {
+		t.Errorf("Expected healthy monitor after a successful scan, got %v", err)
+	}
+
+	monitor.RunStarted(start.Add(3 * time.Hour))
+	monitor.RunFinished(start.Add(4*time.Hour), false)
+
+	if err := monitor.Check(start.Add(6 * time.Hour)); err == nil {
+		t.Error("Expected unhealthy monitor when scans keep failing")
+	}
+}
+
+func TestMonitorCheckWhileRunning(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	monitor := NewMonitor(3*time.Hour, time.Hour, start)
+
+	monitor.RunStarted(start)
+	monitor.Progress(start.Add(3 * time.Hour))
+
+	if err := monitor.Check(start.Add(4 * time.Hour)); err != nil {
+		t.Errorf("Expected healthy monitor during a long run that makes progress, got %v", err)
+	}
+
+	if err := monitor.Check(start.Add(5 * time.Hour)); err == nil {
+		t.Error("Expected unhealthy monitor when a run stopped making progress")
+	}
+
+	// Waiting for the download window counts as progress until the window starts
+	monitor.Progress(start.Add(12 * time.Hour))
+	monitor.Progress(start.Add(5 * time.Hour))
+
+	if err := monitor.Check(start.Add(12 * time.Hour)); err != nil {
+		t.Errorf("Expected healthy monitor while waiting for the download window, got %v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	healthy := httptest.NewServer(Handler(func(ctx context.Context) error { return nil }))
+	defer healthy.Close()
+
+	if err := Probe(t.Context(), healthy.URL); err != nil {
+		t.Errorf("Expected healthy endpoint, got %v", err)
+	}
+
+	unhealthy := httptest.NewServer(Handler(func(ctx context.Context) error { return nil }, func(ctx context.Context) error { return errors.New("yt-dlp not found") }))
+	defer unhealthy.Close()
+
+	if err := Probe(t.Context(), unhealthy.URL); err == nil {
+		t.Error("Expected unhealthy endpoint")
+	}
+}
@@ -0,0 +1,27 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Tracks the scan loop, so a stuck or failing loop can be reported as unhealthy
+type Monitor struct {
+	MaxAge   time.Duration
+	MaxStall time.Duration
+
+	mutex        sync.Mutex
+	startedAt    time.Time
+	lastTick     time.Time
+	lastScan     time.Time
+	lastProgress time.Time
+	isRunning    bool
+}
+
+type Check func(ctx context.Context) error
+
+type status struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
@@ -0,0 +1,97 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"linkding-media-archiver/internal/logging"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Parses a JSON array of hooks
+func Parse(value string) (Hooks, error) {
+	var hooks Hooks
+
+	if strings.TrimSpace(value) == "" {
+		return hooks, nil
+	}
+
+	// Unknown fields are most likely typos, which would otherwise be ignored silently
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&hooks); err != nil {
+		return nil, err
+	}
+
+	for i, hook := range hooks {
+		if strings.TrimSpace(hook.Command) == "" {
+			return nil, fmt.Errorf("hook %d: command is required", i+1)
+		}
+	}
+
+	return hooks, nil
+}
+
+// Hooks without outcomes run for every outcome
+func (hook Hook) Matches(outcome string) bool {
+	return len(hook.Outcomes) == 0 || slices.Contains(hook.Outcomes, outcome)
+}
+
+// Runs the hooks matching the outcome one after another, logging their output and errors instead of returning them
+func (runner Runner) Run(ctx context.Context, outcome string, payload any) {
+	if len(runner.Hooks) == 0 {
+		return
+	}
+
+	input, err := json.Marshal(payload)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to serialize hook payload", "error", err)
+		return
+	}
+
+	for _, hook := range runner.Hooks {
+		if hook.Matches(outcome) {
+			runner.run(ctx, hook, input)
+		}
+	}
+}
+
+func (runner Runner) run(ctx context.Context, hook Hook, input []byte) {
+	logger := logging.FromContext(ctx).With("command", hook.Command)
+
+	if runner.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, runner.Timeout)
+		defer cancel()
+	}
+
+	var output bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Processes started by the shell may keep the output open after the shell is killed, so don't wait for them
+	cmd.WaitDelay = time.Second
+
+	logger.Debug("Running hook")
+	err := cmd.Run()
+	logger = logger.With("output", strings.TrimSpace(output.String()))
+
+	if ctx.Err() != nil {
+		logger.Error("Hook timed out or was cancelled", "error", ctx.Err())
+		return
+	}
+
+	if err != nil {
+		logger.Error("Hook failed", "error", err)
+		return
+	}
+
+	logger.Info("Hook finished")
+}
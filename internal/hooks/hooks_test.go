@@ -0,0 +1,81 @@
+package hooks
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	hooks, err := Parse(`[{"command": "notify.sh", "outcomes": ["archived", "failed"]}, {"command": "index.sh"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hooks) != 2 {
+		t.Fatalf("Expected 2 hooks, got %d", len(hooks))
+	}
+
+	if !hooks[0].Matches("failed") || hooks[0].Matches("skipped") {
+		t.Error("Expected first hook to match only its outcomes")
+	}
+
+	if !hooks[1].Matches("skipped") {
+		t.Error("Expected hook without outcomes to match every outcome")
+	}
+
+	if _, err := Parse(`[{"outcomes": ["archived"]}]`); err == nil {
+		t.Error("Expected error for hook without command")
+	}
+
+	if _, err := Parse(`[{"command": "notify.sh", "outcome": ["archived"]}]`); err == nil {
+		t.Error("Expected error for hook with unknown field")
+	}
+
+	if hooks, err := Parse(" "); err != nil || len(hooks) != 0 {
+		t.Errorf("Expected no hooks for empty value, got %v, %v", hooks, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	archivedFile := filepath.Join(dir, "archived.json")
+	failedFile := filepath.Join(dir, "failed.json")
+
+	runner := Runner{
+		Hooks: Hooks{
+			{Command: "cat > " + archivedFile, Outcomes: []string{"archived"}},
+			{Command: "cat > " + failedFile, Outcomes: []string{"failed"}},
+		},
+		Timeout: 10 * time.Second,
+	}
+
+	runner.Run(t.Context(), "archived", map[string]int{"bookmarkId": 42})
+
+	content, err := os.ReadFile(archivedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var payload map[string]int
+	if err := json.Unmarshal(content, &payload); err != nil || payload["bookmarkId"] != 42 {
+		t.Errorf("Unexpected payload: %s", content)
+	}
+
+	if _, err := os.Stat(failedFile); !os.IsNotExist(err) {
+		t.Error("Expected hook for another outcome not to run")
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	runner := Runner{Hooks: Hooks{{Command: "sleep 10"}}, Timeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	runner.Run(t.Context(), "archived", nil)
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected hook to be stopped after the timeout, took %s", elapsed)
+	}
+}
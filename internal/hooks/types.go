@@ -0,0 +1,16 @@
+package hooks
+
+import "time"
+
+// A shell command that runs after a bookmark is processed, with the event as JSON on stdin
+type Hook struct {
+	Command  string   `json:"command"`
+	Outcomes []string `json:"outcomes"`
+}
+
+type Hooks []Hook
+
+type Runner struct {
+	Hooks   Hooks
+	Timeout time.Duration
+}
@@ -0,0 +1,190 @@
+package job
+
+import (
+	"context"
+	"io"
+	"linkding-media-archiver/internal/linkding"
+	"linkding-media-archiver/internal/logging"
+	"linkding-media-archiver/internal/state"
+	"linkding-media-archiver/internal/ytdlp"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Tracks media downloaded during a run, so bookmarks pointing to the same media share a single download
+type deduplicator struct {
+	store   *state.Store
+	mutex   sync.Mutex
+	entries map[string]*sharedMedia
+}
+
+type sharedMedia struct {
+	bookmarkId int
+	ready      chan struct{}
+	media      *ytdlp.DownloadResult
+	refs       int
+}
+
+func newDeduplicator(store *state.Store) *deduplicator {
+	return &deduplicator{store: store, entries: map[string]*sharedMedia{}}
+}
+
+// Media is identified by the extractor and its media ID, since the same video can be reached through many different URLs
+func mediaKey(probe ytdlp.ProbeResult, profileName string) string {
+	if probe.ExtractorKey == "" || probe.Id == "" {
+		return ""
+	}
+
+	key := probe.ExtractorKey + ":" + probe.Id
+	if profileName != "" {
+		key += "@" + profileName
+	}
+
+	return key
+}
+
+// Returns the shared media for the key, and whether the caller is the first one and has to download it
+func (dedupe *deduplicator) acquire(key string, bookmarkId int) (*sharedMedia, bool) {
+	dedupe.mutex.Lock()
+	defer dedupe.mutex.Unlock()
+
+	if entry, ok := dedupe.entries[key]; ok {
+		entry.refs++
+		return entry, false
+	}
+
+	entry := &sharedMedia{bookmarkId: bookmarkId, ready: make(chan struct{}), refs: 1}
+	dedupe.entries[key] = entry
+	return entry, true
+}
+
+// A nil media means the download failed, and waiting bookmarks have to download it on their own
+func (dedupe *deduplicator) complete(entry *sharedMedia, media *ytdlp.DownloadResult) {
+	entry.media = media
+	close(entry.ready)
+}
+
+// The files are removed once the last bookmark sharing them is done uploading
+func (dedupe *deduplicator) release(key string, entry *sharedMedia) {
+	dedupe.mutex.Lock()
+	defer dedupe.mutex.Unlock()
+
+	entry.refs--
+	if entry.refs > 0 {
+		return
+	}
+
+	if dedupe.entries[key] == entry {
+		delete(dedupe.entries, key)
+	}
+
+	if entry.media != nil {
+		entry.media.Remove()
+	}
+}
+
+// Remembers uploaded media so later runs can copy the assets instead of downloading the media again
+func (dedupe *deduplicator) record(key string, bookmarkId int, assets []linkding.Asset, media ytdlp.DownloadResult) {
+	if _, ok := dedupe.store.Media(key); ok {
+		return
+	}
+
+	record := state.Media{BookmarkId: bookmarkId, Title: media.Title, Description: media.Description, Tags: media.Tags, RecordedAt: time.Now()}
+	for _, asset := range assets {
+		record.Assets = append(record.Assets, state.MediaAsset{Id: asset.Id, DisplayName: asset.DisplayName})
+	}
+
+	dedupe.store.RecordMedia(key, record)
+}
+
+// Downloads media that may already be part of another bookmark, either from earlier in this run or from a previous run
+func downloadShared(ctx context.Context, client *linkding.Client, ytdlp *ytdlp.Ytdlp, dedupe *deduplicator, key string, result *BookmarkResult, profile ytdlp.Profile, config JobConfiguration) (*download, Outcome, error) {
+	bookmark := result.bookmark
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmark.Id, "mediaKey", key)
+
+	entry, isFirst := dedupe.acquire(key, bookmark.Id)
+	release := func() { dedupe.release(key, entry) }
+
+	if !isFirst {
+		logger.Info("Waiting for duplicate media to be downloaded", "duplicateOf", entry.bookmarkId)
+
+		select {
+		case <-entry.ready:
+		case <-ctx.Done():
+			release()
+			return nil, OutcomeCancelled, ctx.Err()
+		}
+
+		if entry.media != nil {
+			return &download{result: *result, media: entry.media, key: key, duplicateOf: entry.bookmarkId, release: release}, "", nil
+		}
+
+		logger.Info("Download of duplicate media failed, downloading it again")
+		release()
+		return downloadFresh(ctx, ytdlp, result, profile, config)
+	}
+
+	if cached, ok := dedupe.store.Media(key); ok && cached.BookmarkId != bookmark.Id {
+		media, err := copyCachedMedia(ctx, client, ytdlp.DownloadDir, cached)
+		if err == nil {
+			logger.Info("Copied media from duplicate bookmark", "duplicateOf", cached.BookmarkId)
+			dedupe.complete(entry, media)
+			return &download{result: *result, media: media, key: key, duplicateOf: cached.BookmarkId, release: release}, "", nil
+		}
+
+		logger.Warn("Failed to copy media from duplicate bookmark, downloading it instead", "duplicateOf", cached.BookmarkId, "error", err)
+		dedupe.store.ForgetMedia(key)
+	}
+
+	download, outcome, err := downloadFresh(ctx, ytdlp, result, profile, config)
+	if download == nil {
+		dedupe.complete(entry, nil)
+		release()
+		return nil, outcome, err
+	}
+
+	dedupe.complete(entry, download.media)
+	download.key, download.release = key, release
+	return download, "", nil
+}
+
+// Downloads the assets of a bookmark that already has the media, so they can be uploaded to another one
+func copyCachedMedia(ctx context.Context, client *linkding.Client, downloadDir string, cached state.Media) (*ytdlp.DownloadResult, error) {
+	dir, err := os.MkdirTemp(downloadDir, "media")
+	if err != nil {
+		return nil, err
+	}
+
+	media := &ytdlp.DownloadResult{Title: cached.Title, Description: cached.Description, Tags: cached.Tags, Dir: dir}
+
+	for _, asset := range cached.Assets {
+		path := filepath.Join(dir, filepath.Base(asset.DisplayName))
+		if err := copyAsset(ctx, client, cached.BookmarkId, asset.Id, path); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+
+		media.Paths = append(media.Paths, path)
+	}
+
+	return media, nil
+}
+
+func copyAsset(ctx context.Context, client *linkding.Client, bookmarkId int, assetId int, path string) error {
+	body, err := client.DownloadBookmarkAsset(ctx, bookmarkId, assetId)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, body)
+	return err
+}
@@ -0,0 +1,56 @@
+package job
+
+import (
+	"linkding-media-archiver/internal/ytdlp"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMediaKey(t *testing.T) {
+	probe := ytdlp.ProbeResult{Id: "RWGTIIO2QiQ", ExtractorKey: "Youtube"}
+
+	if key := mediaKey(probe, ""); key != "Youtube:RWGTIIO2QiQ" {
+		t.Errorf("Unexpected key: %s", key)
+	}
+
+	if key := mediaKey(probe, "audio"); key != "Youtube:RWGTIIO2QiQ@audio" {
+		t.Errorf("Unexpected key with profile: %s", key)
+	}
+
+	if key := mediaKey(ytdlp.ProbeResult{ExtractorKey: "Generic"}, ""); key != "" {
+		t.Errorf("Expected no key for media without an id, got %s", key)
+	}
+}
+
+func TestDeduplicatorRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte("video"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dedupe := newDeduplicator(nil)
+	first, isFirst := dedupe.acquire("Youtube:RWGTIIO2QiQ", 1)
+	second, isSecondFirst := dedupe.acquire("Youtube:RWGTIIO2QiQ", 2)
+
+	if !isFirst || isSecondFirst || first != second || second.bookmarkId != 1 {
+		t.Fatal("Expected the second bookmark to share the download of the first one")
+	}
+
+	dedupe.complete(first, &ytdlp.DownloadResult{Paths: []string{path}})
+	dedupe.release("Youtube:RWGTIIO2QiQ", first)
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("Expected files to be kept while another bookmark still uses them")
+	}
+
+	dedupe.release("Youtube:RWGTIIO2QiQ", second)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected files to be removed after the last bookmark is done")
+	}
+
+	if _, isFirst := dedupe.acquire("Youtube:RWGTIIO2QiQ", 3); !isFirst {
+		t.Error("Expected a released key to be downloaded again")
+	}
+}
@@ -1,85 +1,672 @@
 package job
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"linkding-media-archiver/internal/disk"
 	"linkding-media-archiver/internal/linkding"
+	"linkding-media-archiver/internal/logging"
+	"linkding-media-archiver/internal/metrics"
+	"linkding-media-archiver/internal/notify"
+	"linkding-media-archiver/internal/schedule"
+	"linkding-media-archiver/internal/state"
 	"linkding-media-archiver/internal/ytdlp"
-	"log/slog"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
+	"time"
 )
 
-func ProcessBookmarks(client *linkding.Client, ytdlp *ytdlp.Ytdlp, config JobConfiguration) (err error) {
-	logger := slog.With("tags", config.Tags, "bundleId", config.BundleId, "isDryRun", config.IsDryRun)
+const freeSpaceCheckInterval = 30 * time.Second
+const rollbackTimeout = time.Minute
+const eventWorkers = 4
 
-	bookmarks, err := getBookmarks(client, config)
+// Returned when bookmarks were left unprocessed because the download window ended, so they aren't considered scanned
+var ErrWindowEnded = errors.New("download window ended")
+
+// Cancelling ctx stops processing new bookmarks, and uploads in progress are cancelled after the configured grace period
+func ProcessBookmarks(ctx context.Context, client *linkding.Client, ytdlp *ytdlp.Ytdlp, store *state.Store, config JobConfiguration) (runResult *RunResult, err error) {
+	logger := logging.FromContext(ctx).With("tags", config.Tags, "bundleId", config.BundleId, "isDryRun", config.IsDryRun)
+	runResult = &RunResult{Target: config.Target, StartedAt: time.Now(), IsDryRun: config.IsDryRun, Bookmarks: make([]BookmarkResult, 0)}
+
+	config.Webhooks.Go(ctx, notify.EventRunStarted, RunEvent{Target: config.Target, StartedAt: runResult.StartedAt, IsDryRun: config.IsDryRun})
+
+	defer func() {
+		runResult.finish(err)
+
+		// Report the end of the run even when it was stopped, the caller decides how long to wait for it on exit
+		config.Webhooks.Go(context.WithoutCancel(ctx), notify.EventRunFinished, runResult.event())
+	}()
+
+	bookmarks, err := getBookmarks(ctx, client, store, config)
 	if err != nil {
 		return
 	}
 
 	if len(bookmarks) == 0 {
 		logger.Info("No bookmarks to process")
+
+		// Retries may have been dropped or counted while scanning
+		err = recordResults(ctx, store, nil, config.IsDryRun)
 		return
 	}
 
-	logger.Info("Processing bookmarks", "count", len(bookmarks))
+	logger.Info("Processing bookmarks", "count", len(bookmarks), "downloadWorkers", config.DownloadWorkers, "uploadWorkers", config.UploadWorkers)
+
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	stopGracePeriod := context.AfterFunc(ctx, func() {
+		logger.Warn("Stopping, waiting for uploads in progress to finish", "gracePeriod", config.GracePeriod)
+		time.AfterFunc(config.GracePeriod, cancelWork)
+	})
+	defer stopGracePeriod()
+
+	results := make(chan BookmarkResult, len(bookmarks))
+	dedupe := newDeduplicator(store)
+
+	// Hooks and webhooks run in the background so slow receivers don't hold up the workers
+	eventQueue := make(chan BookmarkResult, len(bookmarks))
+	var eventWg sync.WaitGroup
+
+	for range eventWorkers {
+		eventWg.Go(func() {
+			for result := range eventQueue {
+				event := newBookmarkEvent(config.Target, result)
+				config.Hooks.Run(workCtx, string(result.Outcome), event)
+
+				switch result.Outcome {
+				case OutcomeArchived:
+					config.Webhooks.Notify(workCtx, notify.EventBookmarkArchived, event)
+				case OutcomeFailed:
+					config.Webhooks.Notify(workCtx, notify.EventBookmarkFailed, event)
+				}
+			}
+		})
+	}
+
+	defer func() {
+		close(eventQueue)
+		eventWg.Wait()
+	}()
+
+	finish := func(result BookmarkResult, outcome Outcome, err error) {
+		if outcome == OutcomeFailed && errors.Is(err, context.Canceled) {
+			outcome = OutcomeCancelled
+		}
+
+		bookmark := result.bookmark
+
+		// A cancelled bookmark has no outcome yet, so leave any previous status tag alone
+		if outcome != OutcomeCancelled {
+			var tagErr error
+			bookmark, tagErr = applyStatusTag(workCtx, client, bookmark, outcome, config)
 
-	var wg sync.WaitGroup
-	succeeded := make(chan linkding.Bookmark, len(bookmarks))
-	failed := make(chan linkding.Bookmark, len(bookmarks))
+			// Treat a failed status update as a failure so the bookmark is picked up again later
+			if tagErr != nil && outcome != OutcomeFailed {
+				outcome, err = OutcomeFailed, tagErr
+				result.stage = "tags"
+			}
+		}
+
+		result.bookmark, result.Outcome, result.err = bookmark, outcome, err
+		result.BookmarkId, result.Url = bookmark.Id, bookmark.Url
+
+		if err != nil {
+			result.Error = err.Error()
+		}
+
+		// Bookmarks that already had media were reported when they were archived, so they are left out
+		isAlreadyArchived := outcome == OutcomeArchived && result.media == nil
+
+		if outcome != OutcomeCancelled && !isAlreadyArchived {
+			eventQueue <- result
+		}
+
+		metrics.BookmarksProcessed.Inc(config.Target, string(outcome))
+		if outcome == OutcomeFailed {
+			metrics.BookmarksFailed.Inc(config.Target, result.stage)
+		}
+
+		config.progress(time.Now())
+		results <- result
+	}
+
+	// The upload queue is bounded so downloads pause when the uploads can't keep up
+	downloadQueue := make(chan linkding.Bookmark, len(bookmarks))
+	uploadQueue := make(chan download, config.UploadWorkers)
 
 	for _, bookmark := range bookmarks {
-		hasAsset, err := hasMediaAsset(client, bookmark)
+		downloadQueue <- bookmark
+	}
+	close(downloadQueue)
+
+	// Bookmarks are discovered right away, but downloads wait for the download window and stop when it ends
+	scheduler := schedule.Scheduler{Window: config.DownloadWindow}
+	if config.DownloadWindow != nil {
+		config.progress(config.DownloadWindow.NextStart(time.Now()))
+	}
+
+	scheduler.WaitForWindow(ctx)
+	downloadCtx, stopDownloads := scheduler.WindowContext(ctx)
+	defer stopDownloads()
+
+	var downloadWg, uploadWg sync.WaitGroup
+
+	for range config.DownloadWorkers {
+		downloadWg.Go(func() {
+			for bookmark := range downloadQueue {
+				logging.FromContext(ctx).Debug("Dequeued bookmark for download", "bookmarkId", bookmark.Id, "queueLength", len(downloadQueue))
+				metrics.QueueLength.Set(float64(len(downloadQueue)), "download")
+				result := BookmarkResult{bookmark: bookmark, stage: "download"}
+
+				if downloadCtx.Err() != nil {
+					finish(result, OutcomeCancelled, downloadCtx.Err())
+					continue
+				}
+
+				if err := waitForFreeSpace(downloadCtx, ytdlp.DownloadDir, config.MinFreeSpace); err != nil {
+					finish(result, OutcomeCancelled, err)
+					continue
+				}
+
+				download, outcome, err := downloadBookmark(downloadCtx, client, ytdlp, store, dedupe, &result, config)
+				if download == nil {
+					finish(result, outcome, err)
+					continue
+				}
+
+				uploadQueue <- *download
+				logging.FromContext(ctx).Debug("Queued media for upload", "bookmarkId", bookmark.Id, "queueLength", len(uploadQueue))
+				metrics.QueueLength.Set(float64(len(uploadQueue)), "upload")
+			}
+		})
+	}
+
+	for range config.UploadWorkers {
+		uploadWg.Go(func() {
+			for download := range uploadQueue {
+				result, media := download.result, download.media
+				result.media, result.stage = media, "upload"
+				logging.FromContext(ctx).Debug("Dequeued media for upload", "bookmarkId", result.bookmark.Id, "queueLength", len(uploadQueue))
+				metrics.QueueLength.Set(float64(len(uploadQueue)), "upload")
+
+				if ctx.Err() != nil {
+					download.release()
+					finish(result, OutcomeCancelled, ctx.Err())
+					continue
+				}
+
+				uploadStart := time.Now()
+				assets, undeleted, bytesUploaded, err := uploadMedia(workCtx, client, result.bookmark, media.Paths, config)
+				result.UploadSeconds = time.Since(uploadStart).Seconds()
+				result.BytesUploaded = bytesUploaded
+
+				if !config.IsDryRun {
+					metrics.UploadedBytes.Add(float64(bytesUploaded), config.Target)
+				}
+				result.DuplicateOf = download.duplicateOf
+
+				if err == nil && download.key != "" && !config.IsDryRun {
+					dedupe.record(download.key, result.bookmark.Id, assets, *media)
+				}
+				download.release()
+
+				for _, asset := range assets {
+					result.AssetIds = append(result.AssetIds, asset.Id)
+				}
+
+				for _, asset := range undeleted {
+					result.UndeletedAssetIds = append(result.UndeletedAssetIds, asset.Id)
+				}
+
+				if err != nil {
+					finish(result, OutcomeFailed, err)
+					continue
+				}
+
+				bookmarkConfig := config
+				if rule, ok := ytdlp.Rules.Match(result.bookmark.Url); ok && rule.UpdateBookmarkText != nil {
+					bookmarkConfig.UpdateBookmarkText = *rule.UpdateBookmarkText
+				}
+
+				var extraTags []string
+				if download.duplicateOf != 0 && config.DuplicateTag != "" {
+					extraTags = append(extraTags, config.DuplicateTag)
+				}
+
+				if bookmarkConfig.UpdateBookmarkText || bookmarkConfig.MediaTags.Enabled || len(extraTags) > 0 {
+					result.stage = "update"
+					updated, err := updateBookmark(workCtx, client, result.bookmark, *media, extraTags, bookmarkConfig)
+					if err != nil {
+						finish(result, OutcomeFailed, err)
+						continue
+					}
+
+					result.bookmark = updated
+				}
+
+				finish(result, OutcomeArchived, nil)
+			}
+		})
+	}
+
+	downloadWg.Wait()
+	close(uploadQueue)
+	uploadWg.Wait()
+	close(results)
+
+	for result := range results {
+		runResult.Bookmarks = append(runResult.Bookmarks, result)
+	}
+
+	logger.Info("Done processing bookmarks",
+		"archived", runResult.Count(OutcomeArchived),
+		"skipped", runResult.Count(OutcomeSkipped),
+		"unsupported", runResult.Count(OutcomeUnsupported),
+		"failed", runResult.Count(OutcomeFailed),
+		"cancelled", runResult.Count(OutcomeCancelled),
+	)
+
+	err = errors.Join(recordResults(ctx, store, runResult.Bookmarks, config.IsDryRun), ctx.Err())
+
+	if ctx.Err() == nil && downloadCtx.Err() != nil && runResult.Count(OutcomeCancelled) > 0 {
+		err = errors.Join(err, ErrWindowEnded)
+	}
+
+	return
+}
+
+// Lets the caller know the run is still alive, such as for health checks
+func (config JobConfiguration) progress(at time.Time) {
+	if config.OnProgress != nil {
+		config.OnProgress(at)
+	}
+}
+
+// Returns the media to upload, or the outcome for the bookmark if there is nothing to upload
+func downloadBookmark(ctx context.Context, client *linkding.Client, ytdlp *ytdlp.Ytdlp, store *state.Store, dedupe *deduplicator, result *BookmarkResult, config JobConfiguration) (*download, Outcome, error) {
+	bookmark := result.bookmark
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmark.Id)
+
+	if err := deleteUndeletedAssets(ctx, client, store, result, config.IsDryRun); err != nil {
+		result.stage = "upload"
+		return nil, OutcomeFailed, err
+	}
+
+	hasAsset, err := hasMediaAsset(ctx, client, bookmark)
+	if err != nil {
+		return nil, OutcomeFailed, err
+	}
+
+	if hasAsset {
+		return nil, OutcomeArchived, nil
+	}
+
+	profileName, profile := selectProfile(bookmark, config)
+	if profileName != "" {
+		logger.Debug("Selected download profile", "profile", profileName)
+	}
+
+	limits := ytdlp.EffectiveLimits(profile)
+	result.Profile = profileName
+
+	var key string
+
+	// Limits are checked up front to avoid downloading huge files only to throw them away
+	if config.Probe.Enabled || limits.IsSet() || config.Deduplicate {
+		probe, err := probeMedia(ctx, ytdlp, bookmark, profile)
+		if isUnsupportedUrl(err) {
+			return nil, OutcomeUnsupported, err
+		}
 		if err != nil {
-			failed <- bookmark
-			continue
+			return nil, OutcomeFailed, err
+		}
+
+		reason := checkProbe(*probe, config)
+		if reason == nil {
+			reason = limits.Check(*probe)
+		}
+
+		if reason != nil {
+			logger.Info("Skipping media", "reason", reason)
+			return nil, OutcomeSkipped, reason
+		}
+
+		if config.Deduplicate {
+			key = mediaKey(*probe, profileName)
+		}
+	}
+
+	if key != "" {
+		return downloadShared(ctx, client, ytdlp, dedupe, key, result, profile, config)
+	}
+
+	return downloadFresh(ctx, ytdlp, result, profile, config)
+}
+
+func downloadFresh(ctx context.Context, ytdlp *ytdlp.Ytdlp, result *BookmarkResult, profile ytdlp.Profile, config JobConfiguration) (*download, Outcome, error) {
+	bookmark := result.bookmark
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmark.Id)
+
+	downloadStart := time.Now()
+	media, err := downloadMedia(ctx, ytdlp, bookmark, profile)
+	result.DownloadSeconds = time.Since(downloadStart).Seconds()
+
+	if isUnsupportedUrl(err) {
+		return nil, OutcomeUnsupported, err
+	}
+	if isTooLarge(err) {
+		return nil, OutcomeSkipped, err
+	}
+	if err != nil {
+		return nil, OutcomeFailed, err
+	}
+
+	if !config.Extractors.IsAllowed(media.Extractor, media.ExtractorKey) {
+		logger.Info("Skipping media from disallowed extractor", "extractor", media.Extractor, "extractorKey", media.ExtractorKey)
+		media.Remove()
+		return nil, OutcomeSkipped, fmt.Errorf("extractor %s is not allowed", media.ExtractorKey)
+	}
+
+	for _, path := range media.Paths {
+		if stat, err := os.Stat(path); err == nil {
+			metrics.DownloadedBytes.Add(float64(stat.Size()), config.Target)
 		}
+	}
+
+	return &download{result: *result, media: media, release: media.Remove}, "", nil
+}
+
+// Returns the reason for skipping the media, or nil if it should be downloaded
+func checkProbe(probe ytdlp.ProbeResult, config JobConfiguration) error {
+	if !config.Extractors.IsAllowed(probe.Extractor, probe.ExtractorKey) {
+		return fmt.Errorf("extractor %s is not allowed", probe.ExtractorKey)
+	}
 
-		if hasAsset {
-			succeeded <- bookmark
+	if config.Probe.SkipLive && probe.IsLive {
+		return errors.New("media is a live stream")
+	}
+
+	if config.Probe.SkipPlaylists && probe.EntryCount > 0 {
+		return fmt.Errorf("media is a playlist with %d entries", probe.EntryCount)
+	}
+
+	return nil
+}
+
+// The first profile mapped to one of the bookmark's tags applies, otherwise the default profile
+func selectProfile(bookmark linkding.Bookmark, config JobConfiguration) (string, ytdlp.Profile) {
+	name := config.DefaultProfile
+
+	for _, mapping := range config.ProfileTags {
+		if containsTag(bookmark.TagNames, mapping.Tag) {
+			name = mapping.Profile
+			break
+		}
+	}
+
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return "", ytdlp.Profile{}
+	}
+
+	return name, profile
+}
+
+// Pauses downloads while the work directory is low on space, giving uploads in progress a chance to free some up
+func waitForFreeSpace(ctx context.Context, dir string, minFreeSpace int64) error {
+	if minFreeSpace <= 0 {
+		return nil
+	}
+
+	isPaused := false
+
+	for {
+		free, err := disk.FreeSpace(dir)
+		if err != nil {
+			logging.FromContext(ctx).Warn("Failed to check free disk space", "dir", dir, "error", err)
+			return nil
+		}
+
+		if free >= uint64(minFreeSpace) {
+			if isPaused {
+				logging.FromContext(ctx).Info("Resuming downloads", "freeSpace", free)
+			}
+
+			return nil
+		}
+
+		if !isPaused {
+			logging.FromContext(ctx).Warn("Pausing downloads, low disk space", "dir", dir, "freeSpace", free, "minFreeSpace", minFreeSpace)
+			isPaused = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(freeSpaceCheckInterval):
+		}
+	}
+}
+
+func getBookmarks(ctx context.Context, client *linkding.Client, store *state.Store, config JobConfiguration) ([]linkding.Bookmark, error) {
+	var bookmarks []linkding.Bookmark
+
+	if !config.SkipScan {
+		scanned, err := scanBookmarks(ctx, client, store, config)
+		if err != nil {
+			return nil, err
+		}
+
+		bookmarks = scanned
+	}
+
+	// Requested bookmarks are processed regardless of their tags and retry schedule
+	for _, bookmarkId := range config.BookmarkIds {
+		logger := logging.FromContext(ctx).With("bookmarkId", bookmarkId)
+
+		if slices.ContainsFunc(bookmarks, func(bookmark linkding.Bookmark) bool { return bookmark.Id == bookmarkId }) {
 			continue
 		}
 
-		result, err := downloadMedia(ytdlp, bookmark)
+		bookmark, err := client.GetBookmark(ctx, bookmarkId)
 		if err != nil {
-			failed <- bookmark
+			logger.Warn("Failed to fetch requested bookmark", "error", err)
 			continue
 		}
 
-		wg.Go(func() {
-			if err := uploadMedia(client, bookmark, result.Paths, config.IsDryRun); err != nil {
-				failed <- bookmark
-				return
+		logger.Info("Archiving requested bookmark")
+		bookmarks = append(bookmarks, *bookmark)
+	}
+
+	return bookmarks, nil
+}
+
+func scanBookmarks(ctx context.Context, client *linkding.Client, store *state.Store, config JobConfiguration) ([]linkding.Bookmark, error) {
+	query := linkding.BookmarksQuery{Tags: config.Tags, BundleId: config.BundleId, ModifiedSince: config.LastScan}
+	bookmarks, err := client.GetBookmarks(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	bookmarks = slices.DeleteFunc(bookmarks, func(bookmark linkding.Bookmark) bool {
+		return isRetryDeferred(ctx, store, bookmark, now)
+	})
+
+	// Adding the status tag modified the bookmark, so it shows up in the next scan without anything left to do
+	bookmarks = slices.DeleteFunc(bookmarks, func(bookmark linkding.Bookmark) bool {
+		tag, ok := finalStatusTag(bookmark, config.StatusTags)
+		if ok {
+			logging.FromContext(ctx).Debug("Skipping bookmark that was already processed", "bookmarkId", bookmark.Id, "statusTag", tag)
+		}
+
+		return ok
+	})
+
+	// Bookmarks don't tell which bundles they are in, so the bundle is listed once if a retry needs it
+	var bundleBookmarkIds []int
+	isInBundle := func(bookmarkId int) (bool, error) {
+		if config.BundleId == 0 {
+			return true, nil
+		}
+
+		if bundleBookmarkIds == nil {
+			bundled, err := client.GetBookmarks(ctx, linkding.BookmarksQuery{BundleId: config.BundleId})
+			if err != nil {
+				return false, err
 			}
 
-			if config.UpdateBookmarkText {
-				if err := updateBookmark(client, bookmark, *result, config.IsDryRun); err != nil {
-					failed <- bookmark
-					return
-				}
+			bundleBookmarkIds = make([]int, 0, len(bundled))
+			for _, bookmark := range bundled {
+				bundleBookmarkIds = append(bundleBookmarkIds, bookmark.Id)
 			}
+		}
 
-			succeeded <- bookmark
-		})
+		return slices.Contains(bundleBookmarkIds, bookmarkId), nil
 	}
 
-	wg.Wait()
+	// Merge in failed bookmarks that are due for another attempt, even if they were not modified since the last scan
+	for _, failure := range store.DueFailures(now) {
+		logger := logging.FromContext(ctx).With("bookmarkId", failure.BookmarkId, "attempts", failure.Attempts)
 
-	logger.Info("Done processing bookmarks", "succeeded", len(succeeded), "failed", len(failed))
+		if slices.ContainsFunc(bookmarks, func(bookmark linkding.Bookmark) bool { return bookmark.Id == failure.BookmarkId }) {
+			continue
+		}
 
-	return
+		bookmark, err := client.GetBookmark(ctx, failure.BookmarkId)
+		if errors.Is(err, linkding.ErrNotFound) {
+			logger.Info("Dropping retry for bookmark that was deleted")
+			store.Forget(failure.BookmarkId)
+			continue
+		}
+
+		// Count the failed fetch as an attempt, so the retry backs off like any other failure
+		if err != nil {
+			logger.Warn("Failed to fetch bookmark for retry", "error", err)
+			store.RecordFailure(failure.BookmarkId, failure.BookmarkModified, failure.Url, err, failure.UndeletedAssetIds, now)
+			continue
+		}
+
+		if len(config.Tags) > 0 && !slices.ContainsFunc(bookmark.TagNames, func(tag string) bool { return slices.Contains(config.Tags, tag) }) {
+			logger.Info("Dropping retry for bookmark that no longer matches the configured tags")
+			store.Forget(failure.BookmarkId)
+			continue
+		}
+
+		isBundled, err := isInBundle(bookmark.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isBundled {
+			logger.Info("Dropping retry for bookmark that is no longer in the configured bundle")
+			store.Forget(failure.BookmarkId)
+			continue
+		}
+
+		logger.Info("Retrying failed bookmark", "lastError", failure.Error)
+		bookmarks = append(bookmarks, *bookmark)
+	}
+
+	return bookmarks, nil
 }
 
-func getBookmarks(client *linkding.Client, config JobConfiguration) ([]linkding.Bookmark, error) {
-	query := linkding.BookmarksQuery{Tags: config.Tags, BundleId: config.BundleId, ModifiedSince: config.LastScan}
-	return client.GetBookmarks(query)
+func isRetryDeferred(ctx context.Context, store *state.Store, bookmark linkding.Bookmark, now time.Time) bool {
+	failure, ok := store.Failure(bookmark.Id)
+	if !ok {
+		return false
+	}
+
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmark.Id, "attempts", failure.Attempts)
+
+	// The bookmark was edited in Linkding after it failed, so give it a fresh start
+	if bookmark.DateModified.After(failure.BookmarkModified) {
+		logger.Info("Bookmark changed since it failed, resetting retries")
+		store.ResetRetries(bookmark.Id)
+		return false
+	}
+
+	if store.IsDue(failure, now) {
+		return false
+	}
+
+	logger.Debug("Deferring failed bookmark", "nextAttempt", failure.NextAttempt, "isExhausted", store.IsExhausted(failure))
+	return true
 }
 
-func hasMediaAsset(client *linkding.Client, bookmark linkding.Bookmark) (bool, error) {
-	logger := slog.With("bookmarkId", bookmark.Id)
-	assets, err := client.GetBookmarkAssets(bookmark.Id)
+func recordResults(ctx context.Context, store *state.Store, results []BookmarkResult, isDryRun bool) error {
+	if isDryRun {
+		return nil
+	}
+
+	now := time.Now()
+
+	for _, result := range results {
+		bookmark := result.bookmark
+		logger := logging.FromContext(ctx).With("bookmarkId", bookmark.Id)
+
+		// Cancelled bookmarks were never attempted, so their retry schedule is left as is
+		if result.Outcome == OutcomeCancelled {
+			continue
+		}
+
+		// Skipped bookmarks and unsupported URLs will end up the same way every time, so there's no point in retrying them
+		if result.Outcome != OutcomeFailed {
+			store.Forget(bookmark.Id)
+			continue
+		}
+
+		recorded := store.RecordFailure(bookmark.Id, bookmark.DateModified, bookmark.Url, result.err, result.UndeletedAssetIds, now)
+
+		if store.IsExhausted(recorded) {
+			logger.Warn("Giving up on bookmark after repeated failures", "attempts", recorded.Attempts, "error", result.err)
+		} else {
+			logger.Info("Scheduled retry for bookmark", "attempts", recorded.Attempts, "nextAttempt", recorded.NextAttempt)
+		}
+	}
+
+	if err := store.Save(); err != nil {
+		logging.FromContext(ctx).Error("Failed to save state", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// Deletes the assets a previous attempt failed to roll back, as they would otherwise make the bookmark look archived
+func deleteUndeletedAssets(ctx context.Context, client *linkding.Client, store *state.Store, result *BookmarkResult, isDryRun bool) error {
+	failure, ok := store.Failure(result.bookmark.Id)
+	if !ok || len(failure.UndeletedAssetIds) == 0 {
+		return nil
+	}
+
+	assets := make([]linkding.Asset, 0, len(failure.UndeletedAssetIds))
+	for _, assetId := range failure.UndeletedAssetIds {
+		assets = append(assets, linkding.Asset{Id: assetId})
+	}
+
+	remaining := deleteAssets(ctx, client, result.bookmark, assets, isDryRun)
+	if len(remaining) == 0 {
+		return nil
+	}
+
+	for _, asset := range remaining {
+		result.UndeletedAssetIds = append(result.UndeletedAssetIds, asset.Id)
+	}
+
+	return fmt.Errorf("failed to delete %d assets left over from a previous attempt", len(remaining))
+}
+
+func hasMediaAsset(ctx context.Context, client *linkding.Client, bookmark linkding.Bookmark) (bool, error) {
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmark.Id)
+	assets, err := client.GetBookmarkAssets(ctx, bookmark.Id)
 
 	if err != nil {
 		logger.Error("Failed to fetch bookmark assets")
@@ -98,10 +685,24 @@ func hasMediaAsset(client *linkding.Client, bookmark linkding.Bookmark) (bool, e
 	return false, nil
 }
 
-func downloadMedia(ytdlp *ytdlp.Ytdlp, bookmark linkding.Bookmark) (*ytdlp.DownloadResult, error) {
-	logger := slog.With("bookmarkId", bookmark.Id)
+func probeMedia(ctx context.Context, ytdlp *ytdlp.Ytdlp, bookmark linkding.Bookmark, profile ytdlp.Profile) (*ytdlp.ProbeResult, error) {
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmark.Id)
+	logger.Info("Probing media")
+	result, err := ytdlp.Probe(ctx, bookmark.Url, profile)
+
+	if err != nil {
+		logger.Error("Failed to probe media", "error", err)
+		return nil, err
+	}
+
+	logger.Info("Media probed successfully", "result", result)
+	return result, nil
+}
+
+func downloadMedia(ctx context.Context, ytdlp *ytdlp.Ytdlp, bookmark linkding.Bookmark, profile ytdlp.Profile) (*ytdlp.DownloadResult, error) {
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmark.Id)
 	logger.Info("Downloading media")
-	result, err := ytdlp.DownloadMedia(bookmark.Url)
+	result, err := ytdlp.DownloadMedia(ctx, bookmark.Url, profile)
 
 	if err != nil {
 		logger.Error("Failed to download media", "error", err)
@@ -112,37 +713,118 @@ func downloadMedia(ytdlp *ytdlp.Ytdlp, bookmark linkding.Bookmark) (*ytdlp.Downl
 	return result, nil
 }
 
-func uploadMedia(client *linkding.Client, bookmark linkding.Bookmark, paths []string, isDryRun bool) error {
-	logger := slog.With("bookmarkId", bookmark.Id, "isDryRun", isDryRun)
+func isUnsupportedUrl(err error) bool {
+	return errors.Is(err, ytdlp.ErrUnsupportedUrl)
+}
+
+func isTooLarge(err error) bool {
+	return errors.Is(err, ytdlp.ErrTooLarge)
+}
 
+// Uploads all files or none, so a bookmark never ends up with part of a playlist that would look archived on the next run
+// Assets that couldn't be deleted are returned separately, as they are still attached to the bookmark
+func uploadMedia(ctx context.Context, client *linkding.Client, bookmark linkding.Bookmark, paths []string, config JobConfiguration) (assets []linkding.Asset, undeleted []linkding.Asset, bytesUploaded int64, err error) {
 	for _, path := range paths {
-		logger := logger.With("path", path)
-		logger.Info("Adding asset")
+		asset, mismatched, size, err := uploadFile(ctx, client, bookmark, path, config)
+		undeleted = append(undeleted, mismatched...)
 
-		file, err := os.Open(path)
+		if asset != nil {
+			assets = append(assets, *asset)
+		}
 
 		if err != nil {
-			logger.Error("Failed to open media file", "error", err)
-			return err
+			remaining := deleteAssets(ctx, client, bookmark, assets, config.IsDryRun)
+			return nil, append(undeleted, remaining...), 0, err
 		}
 
-		defer file.Close()
-		defer os.Remove(path)
+		bytesUploaded += size
+	}
 
-		asset, err := uploadAsset(client, bookmark, file, isDryRun)
+	return assets, undeleted, bytesUploaded, nil
+}
+
+// Uploads the file again if the uploaded asset doesn't match it, up to the configured number of retries, and returns the mismatched assets that couldn't be deleted
+func uploadFile(ctx context.Context, client *linkding.Client, bookmark linkding.Bookmark, path string, config JobConfiguration) (*linkding.Asset, []linkding.Asset, int64, error) {
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmark.Id, "isDryRun", config.IsDryRun, "path", path)
+	file, err := os.Open(path)
+
+	if err != nil {
+		logger.Error("Failed to open media file", "error", err)
+		return nil, nil, 0, err
+	}
+
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	shouldVerify := config.Verify.Enabled && !config.IsDryRun
+	var undeleted []linkding.Asset
+
+	for attempt := 0; ; attempt++ {
+		logger.Info("Adding asset", "attempt", attempt+1)
+
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, undeleted, 0, err
+		}
+
+		asset, err := uploadAsset(ctx, client, bookmark, file, config.IsDryRun)
 
 		if err != nil {
 			logger.Error("Failed to add asset", "error", err)
-			return err
+			return nil, undeleted, 0, err
 		}
 
 		logger.Info("Asset added successfully", "assetId", asset.Id)
+
+		if !shouldVerify {
+			return asset, undeleted, stat.Size(), nil
+		}
+
+		err = verifyAsset(ctx, client, bookmark, *asset, file, config.Verify.Checksum)
+
+		if err == nil {
+			logger.Info("Asset verified successfully", "assetId", asset.Id)
+			return asset, undeleted, stat.Size(), nil
+		}
+
+		if !errors.Is(err, errAssetMismatch) || attempt >= config.Verify.Retries {
+			logger.Error("Failed to verify asset", "assetId", asset.Id, "error", err)
+			return asset, undeleted, stat.Size(), err
+		}
+
+		logger.Warn("Uploaded asset doesn't match media file, uploading it again", "assetId", asset.Id, "error", err)
+		undeleted = append(undeleted, deleteAssets(ctx, client, bookmark, []linkding.Asset{*asset}, config.IsDryRun)...)
 	}
+}
 
-	return nil
+// Deletes the assets even if ctx was cancelled, and returns the ones that couldn't be deleted
+func deleteAssets(ctx context.Context, client *linkding.Client, bookmark linkding.Bookmark, assets []linkding.Asset, isDryRun bool) []linkding.Asset {
+	if isDryRun || len(assets) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	var remaining []linkding.Asset
+
+	for _, asset := range assets {
+		logger := logging.FromContext(ctx).With("bookmarkId", bookmark.Id, "assetId", asset.Id)
+		logger.Info("Deleting asset")
+
+		if err := client.DeleteBookmarkAsset(ctx, bookmark.Id, asset.Id); err != nil {
+			logger.Error("Failed to delete asset", "error", err)
+			remaining = append(remaining, asset)
+		}
+	}
+
+	return remaining
 }
 
-func uploadAsset(client *linkding.Client, bookmark linkding.Bookmark, file *os.File, isDryRun bool) (*linkding.Asset, error) {
+func uploadAsset(ctx context.Context, client *linkding.Client, bookmark linkding.Bookmark, file *os.File, isDryRun bool) (*linkding.Asset, error) {
 	if isDryRun {
 		mimeType, err := linkding.GetMimeType(file.Name())
 		if err != nil {
@@ -153,35 +835,60 @@ func uploadAsset(client *linkding.Client, bookmark linkding.Bookmark, file *os.F
 		return asset, nil
 	}
 
-	return client.AddBookmarkAsset(bookmark.Id, file)
+	return client.AddBookmarkAsset(ctx, bookmark.Id, file)
 }
 
-func updateBookmark(client *linkding.Client, bookmark linkding.Bookmark, result ytdlp.DownloadResult, isDryRun bool) error {
-	logger := slog.With("bookmarkId", bookmark.Id, "isDryRun", isDryRun)
+func updateBookmark(ctx context.Context, client *linkding.Client, bookmark linkding.Bookmark, result ytdlp.DownloadResult, extraTags []string, config JobConfiguration) (linkding.Bookmark, error) {
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmark.Id, "isDryRun", config.IsDryRun)
 	update := linkding.BookmarkUpdate{Title: bookmark.Title, Description: bookmark.Description}
 
-	if strings.TrimSpace(result.Title) != "" {
-		update.Title = result.Title
+	if config.UpdateBookmarkText {
+		if strings.TrimSpace(result.Title) != "" {
+			update.Title = result.Title
+		}
+		if strings.TrimSpace(result.Description) != "" {
+			update.Description = result.Description
+		}
 	}
-	if strings.TrimSpace(result.Description) != "" {
-		update.Description = result.Description
+
+	var addedTags []string
+	if config.MediaTags.Enabled {
+		addedTags = mediaTags(result.Tags, bookmark.TagNames, config.MediaTags)
 	}
 
-	hasChanges := update.Title != bookmark.Title || update.Description != bookmark.Description
+	for _, tag := range extraTags {
+		if !containsTag(bookmark.TagNames, tag) && !containsTag(addedTags, tag) {
+			addedTags = append(addedTags, tag)
+		}
+	}
+
+	if len(addedTags) > 0 {
+		update.TagNames = append(slices.Clone(bookmark.TagNames), addedTags...)
+	}
+
+	hasChanges := update.Title != bookmark.Title || update.Description != bookmark.Description || len(addedTags) > 0
 	if !hasChanges {
 		logger.Info("Skipping bookmark update as there are no changes")
-		return nil
+		return bookmark, nil
 	}
 
-	logger.Info("Updating bookmark", "title", update.Title, "description", update.Description, "oldTitle", bookmark.Title, "oldDescription", bookmark.Description)
+	logger.Info("Updating bookmark", "title", update.Title, "description", update.Description, "addedTags", addedTags, "oldTitle", bookmark.Title, "oldDescription", bookmark.Description)
 
-	if !isDryRun {
-		if _, err := client.UpdateBookmark(bookmark.Id, update); err != nil {
-			logger.Error("Failed to update bookmark", "error", err)
-			return err
+	if config.IsDryRun {
+		bookmark.Title, bookmark.Description = update.Title, update.Description
+		if update.TagNames != nil {
+			bookmark.TagNames = update.TagNames
 		}
+
+		return bookmark, nil
+	}
+
+	updated, err := client.UpdateBookmark(ctx, bookmark.Id, update)
+	if err != nil {
+		logger.Error("Failed to update bookmark", "error", err)
+		return bookmark, err
 	}
 
 	logger.Info("Updated bookmark")
-	return nil
+	return *updated, nil
 }
@@ -0,0 +1,202 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"linkding-media-archiver/internal/linkding"
+	"linkding-media-archiver/internal/state"
+	"linkding-media-archiver/internal/ytdlp"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeleteUndeletedAssets(t *testing.T) {
+	var deleted []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.NotFound(w, r)
+			return
+		}
+
+		deleted = append(deleted, r.URL.Path)
+
+		switch r.URL.Path {
+		case "/api/bookmarks/1/assets/7/":
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/bookmarks/1/assets/8/":
+			http.NotFound(w, r)
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	client, err := linkding.NewClient(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := state.Open(t.TempDir(), state.RetryPolicy{InitialDelay: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	store.RecordFailure(1, now, "https://example.com", errors.New("upload failed"), []int{7, 8, 9}, now)
+
+	result := BookmarkResult{bookmark: linkding.Bookmark{Id: 1}}
+	err = deleteUndeletedAssets(t.Context(), client, store, &result, false)
+
+	if err == nil {
+		t.Error("Expected an error while an asset couldn't be deleted")
+	}
+
+	if len(deleted) != 3 {
+		t.Errorf("Expected every undeleted asset to be deleted, got %v", deleted)
+	}
+
+	if !slices.Equal(result.UndeletedAssetIds, []int{9}) {
+		t.Errorf("Expected only asset 9 to remain, got %v", result.UndeletedAssetIds)
+	}
+
+	result = BookmarkResult{bookmark: linkding.Bookmark{Id: 2}}
+	if err := deleteUndeletedAssets(t.Context(), client, store, &result, false); err != nil {
+		t.Errorf("Expected no error for a bookmark without failures, got %v", err)
+	}
+}
+
+func TestStatusTaggedBookmarksAreNotProcessedAgain(t *testing.T) {
+	var mutex sync.Mutex
+	bookmark := linkding.Bookmark{Id: 1, Url: "https://example.com/video", DateModified: time.Now().Add(-time.Hour)}
+	assetRequests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/bookmarks/":
+			bookmarks := []linkding.Bookmark{}
+			since, _ := time.Parse(time.RFC3339, r.URL.Query().Get("modified_since"))
+			if bookmark.DateModified.After(since) {
+				bookmarks = append(bookmarks, bookmark)
+			}
+
+			json.NewEncoder(w).Encode(linkding.PagedResponse[linkding.Bookmark]{Count: len(bookmarks), Results: bookmarks})
+		case r.Method == http.MethodGet && r.URL.Path == "/api/bookmarks/1/assets/":
+			assetRequests++
+			assets := []linkding.Asset{{Id: 5, AssetType: "upload", ContentType: "video/mp4"}}
+			json.NewEncoder(w).Encode(linkding.PagedResponse[linkding.Asset]{Count: len(assets), Results: assets})
+		case r.Method == http.MethodPatch && r.URL.Path == "/api/bookmarks/1/":
+			var update linkding.BookmarkUpdate
+			json.NewDecoder(r.Body).Decode(&update)
+
+			// Linkding bumps the modification date on every update
+			bookmark.TagNames, bookmark.DateModified = update.TagNames, time.Now()
+			json.NewEncoder(w).Encode(bookmark)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := linkding.NewClient(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := state.Open(t.TempDir(), state.RetryPolicy{InitialDelay: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := JobConfiguration{DownloadWorkers: 1, UploadWorkers: 1, StatusTags: map[Outcome]string{OutcomeArchived: "archived"}}
+
+	first, err := ProcessBookmarks(t.Context(), client, &ytdlp.Ytdlp{}, store, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Count(OutcomeArchived) != 1 || !slices.Equal(bookmark.TagNames, []string{"archived"}) {
+		t.Fatalf("Expected the bookmark to be archived and tagged, got %+v with tags %v", first.Bookmarks, bookmark.TagNames)
+	}
+
+	config.LastScan = first.StartedAt
+	second, err := ProcessBookmarks(t.Context(), client, &ytdlp.Ytdlp{}, store, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(second.Bookmarks) != 0 || assetRequests != 1 {
+		t.Errorf("Expected the tagged bookmark not to be processed again, got %+v after %d asset requests", second.Bookmarks, assetRequests)
+	}
+}
+
+func TestScanBookmarksRetries(t *testing.T) {
+	bookmarks := map[string]linkding.Bookmark{
+		"/api/bookmarks/2/": {Id: 2, Url: "https://example.com/2"},
+		"/api/bookmarks/3/": {Id: 3, Url: "https://example.com/3"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/bookmarks/":
+			// Only bookmark 2 is still in the bundle, and none were modified since the last scan
+			results := []linkding.Bookmark{}
+			if r.URL.Query().Get("modified_since") == "" && r.URL.Query().Get("bundle") == "7" {
+				results = append(results, bookmarks["/api/bookmarks/2/"])
+			}
+
+			json.NewEncoder(w).Encode(linkding.PagedResponse[linkding.Bookmark]{Count: len(results), Results: results})
+		case r.URL.Path == "/api/bookmarks/4/":
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			bookmark, ok := bookmarks[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+
+			json.NewEncoder(w).Encode(bookmark)
+		}
+	}))
+	defer server.Close()
+
+	client, err := linkding.NewClient(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := state.Open(t.TempDir(), state.RetryPolicy{InitialDelay: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failedAt := time.Now().Add(-2 * time.Hour)
+	for bookmarkId := 1; bookmarkId <= 4; bookmarkId++ {
+		store.RecordFailure(bookmarkId, failedAt, "https://example.com", errors.New("download failed"), nil, failedAt)
+	}
+
+	config := JobConfiguration{BundleId: 7, LastScan: time.Now()}
+	scanned, err := scanBookmarks(t.Context(), client, store, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scanned) != 1 || scanned[0].Id != 2 {
+		t.Errorf("Expected only bookmark 2 to be retried, got %+v", scanned)
+	}
+
+	// Bookmark 1 was deleted and bookmark 3 left the bundle, bookmark 4 couldn't be fetched
+	for bookmarkId, expectedAttempts := range map[int]int{1: 0, 2: 1, 3: 0, 4: 2} {
+		failure, _ := store.Failure(bookmarkId)
+		if failure.Attempts != expectedAttempts {
+			t.Errorf("Expected %d attempts for bookmark %d, got %d", expectedAttempts, bookmarkId, failure.Attempts)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package job
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func (runResult *RunResult) Count(outcome Outcome) int {
+	count := 0
+
+	for _, result := range runResult.Bookmarks {
+		if result.Outcome == outcome {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (runResult *RunResult) WriteFile(path string) error {
+	content, err := json.MarshalIndent(runResult, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, content, 0o644)
+}
+
+func (runResult *RunResult) finish(err error) {
+	runResult.FinishedAt = time.Now()
+	runResult.DurationSeconds = runResult.FinishedAt.Sub(runResult.StartedAt).Seconds()
+	runResult.Counts = map[Outcome]int{}
+
+	for _, result := range runResult.Bookmarks {
+		runResult.Counts[result.Outcome]++
+	}
+
+	if err != nil {
+		runResult.Error = err.Error()
+	}
+}
+
+func (runResult *RunResult) event() RunEvent {
+	return RunEvent{
+		Target:          runResult.Target,
+		StartedAt:       runResult.StartedAt,
+		FinishedAt:      runResult.FinishedAt,
+		DurationSeconds: runResult.DurationSeconds,
+		IsDryRun:        runResult.IsDryRun,
+		Error:           runResult.Error,
+		Counts:          runResult.Counts,
+	}
+}
+
+func newBookmarkEvent(target string, result BookmarkResult) BookmarkEvent {
+	bookmark := result.bookmark
+	event := BookmarkEvent{
+		Target:   target,
+		Outcome:  result.Outcome,
+		Bookmark: EventBookmark{Id: bookmark.Id, Url: bookmark.Url, Title: bookmark.Title, Description: bookmark.Description, Tags: bookmark.TagNames},
+		AssetIds: result.AssetIds,
+		Error:    result.Error,
+	}
+
+	if media := result.media; media != nil {
+		event.Media = &EventMedia{Title: media.Title, Description: media.Description, Tags: media.Tags, Extractor: media.Extractor, ExtractorKey: media.ExtractorKey}
+
+		for _, path := range media.Paths {
+			event.Media.Files = append(event.Media.Files, filepath.Base(path))
+		}
+	}
+
+	return event
+}
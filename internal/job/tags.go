@@ -0,0 +1,143 @@
+package job
+
+import (
+	"context"
+	"linkding-media-archiver/internal/linkding"
+	"linkding-media-archiver/internal/logging"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Linkding rejects tag names longer than this
+const maxTagLength = 64
+
+func applyStatusTag(ctx context.Context, client *linkding.Client, bookmark linkding.Bookmark, outcome Outcome, config JobConfiguration) (linkding.Bookmark, error) {
+	if len(config.StatusTags) == 0 {
+		return bookmark, nil
+	}
+
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmark.Id, "outcome", outcome, "isDryRun", config.IsDryRun)
+
+	// Remove the tags of any previous outcome before adding the current one
+	tagNames := slices.DeleteFunc(slices.Clone(bookmark.TagNames), func(tag string) bool {
+		return isStatusTag(tag, config.StatusTags)
+	})
+
+	if tag := config.StatusTags[outcome]; tag != "" {
+		tagNames = append(tagNames, tag)
+	}
+
+	if sameTags(tagNames, bookmark.TagNames) {
+		logger.Debug("Status tags are up to date")
+		return bookmark, nil
+	}
+
+	logger.Info("Updating status tags", "tagNames", tagNames, "oldTagNames", bookmark.TagNames)
+
+	if config.IsDryRun {
+		return bookmark, nil
+	}
+
+	updated, err := client.UpdateBookmark(ctx, bookmark.Id, linkding.BookmarkUpdate{TagNames: tagNames})
+
+	if err != nil {
+		logger.Error("Failed to update status tags", "error", err)
+		return bookmark, err
+	}
+
+	return *updated, nil
+}
+
+// Returns the tag of an earlier outcome that another attempt wouldn't change, failures are retried on their own schedule
+func finalStatusTag(bookmark linkding.Bookmark, statusTags map[Outcome]string) (string, bool) {
+	for _, outcome := range []Outcome{OutcomeArchived, OutcomeSkipped, OutcomeUnsupported} {
+		if tag := statusTags[outcome]; tag != "" && containsTag(bookmark.TagNames, tag) {
+			return tag, true
+		}
+	}
+
+	return "", false
+}
+
+func isStatusTag(tag string, statusTags map[Outcome]string) bool {
+	for _, statusTag := range statusTags {
+		if strings.EqualFold(tag, statusTag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sameTags(a []string, b []string) bool {
+	normalize := func(tags []string) []string {
+		normalized := make([]string, len(tags))
+		for i, tag := range tags {
+			normalized[i] = strings.ToLower(tag)
+		}
+
+		slices.Sort(normalized)
+		return slices.Compact(normalized)
+	}
+
+	return slices.Equal(normalize(a), normalize(b))
+}
+
+// Returns the normalized media tags that should be added to a bookmark with the given existing tags
+func mediaTags(tags []string, existingTags []string, options MediaTagOptions) []string {
+	added := make([]string, 0)
+
+	for _, tag := range tags {
+		if options.MaxCount > 0 && len(added) >= options.MaxCount {
+			break
+		}
+
+		tag = normalizeTag(tag)
+
+		if tag == "" {
+			continue
+		}
+
+		if len(options.Allow) > 0 && !containsTag(options.Allow, tag) {
+			continue
+		}
+
+		if containsTag(options.Deny, tag) {
+			continue
+		}
+
+		tag = truncateTag(options.Prefix + tag)
+
+		if containsTag(existingTags, tag) || containsTag(added, tag) {
+			continue
+		}
+
+		added = append(added, tag)
+	}
+
+	return added
+}
+
+// Linkding separates tags by whitespace and treats # as the start of a tag in searches
+func normalizeTag(tag string) string {
+	words := strings.FieldsFunc(strings.ToLower(tag), func(r rune) bool {
+		return unicode.IsSpace(r) || r == ',' || r == '#'
+	})
+
+	return strings.Join(words, "-")
+}
+
+func truncateTag(tag string) string {
+	runes := []rune(tag)
+
+	if len(runes) <= maxTagLength {
+		return tag
+	}
+
+	return string(runes[:maxTagLength])
+}
+
+func containsTag(tags []string, tag string) bool {
+	return slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) })
+}
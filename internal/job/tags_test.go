@@ -0,0 +1,60 @@
+package job
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		tag      string
+		expected string
+	}{
+		{"music", "music"},
+		{"Tokyo Station  Melody", "tokyo-station-melody"},
+		{" #hashtag ", "hashtag"},
+		{"rock, pop", "rock-pop"},
+		{"駅のメロディー", "駅のメロディー"},
+		{"   ", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.tag, func(t *testing.T) {
+			actual := normalizeTag(test.tag)
+
+			if actual != test.expected {
+				t.Errorf("Expected %s to be normalized to %s, got %s", test.tag, test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMediaTags(t *testing.T) {
+	mediaTagNames := []string{"Music", "Live Concert", "vlog", "music", "Jazz"}
+
+	tests := []struct {
+		name         string
+		existingTags []string
+		options      MediaTagOptions
+		expected     []string
+	}{
+		{"all", nil, MediaTagOptions{}, []string{"music", "live-concert", "vlog", "jazz"}},
+		{"existing", []string{"MUSIC"}, MediaTagOptions{}, []string{"live-concert", "vlog", "jazz"}},
+		{"allow", nil, MediaTagOptions{Allow: []string{"jazz", "live-concert"}}, []string{"live-concert", "jazz"}},
+		{"deny", nil, MediaTagOptions{Deny: []string{"vlog"}}, []string{"music", "live-concert", "jazz"}},
+		{"prefix", []string{"yt-music"}, MediaTagOptions{Prefix: "yt-"}, []string{"yt-live-concert", "yt-vlog", "yt-jazz"}},
+		{"max", nil, MediaTagOptions{MaxCount: 2}, []string{"music", "live-concert"}},
+		{"long", nil, MediaTagOptions{Allow: []string{"music"}, Prefix: strings.Repeat("x", 70)}, []string{strings.Repeat("x", maxTagLength)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := mediaTags(mediaTagNames, test.existingTags, test.options)
+
+			if !slices.Equal(actual, test.expected) {
+				t.Errorf("Expected tags %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
@@ -1,11 +1,150 @@
 package job
 
-import "time"
+import (
+	"linkding-media-archiver/internal/hooks"
+	"linkding-media-archiver/internal/linkding"
+	"linkding-media-archiver/internal/notify"
+	"linkding-media-archiver/internal/schedule"
+	"linkding-media-archiver/internal/ytdlp"
+	"time"
+)
 
 type JobConfiguration struct {
+	Target             string
 	Tags               []string
 	BundleId           int
 	UpdateBookmarkText bool
 	IsDryRun           bool
 	LastScan           time.Time
+	DownloadWorkers    int
+	UploadWorkers      int
+	StatusTags         map[Outcome]string
+	MediaTags          MediaTagOptions
+	GracePeriod        time.Duration
+	Extractors         ytdlp.ExtractorFilter
+	Probe              ProbeRules
+	Profiles           map[string]ytdlp.Profile
+	ProfileTags        []ProfileTag
+	DefaultProfile     string
+	Deduplicate        bool
+	DuplicateTag       string
+	MinFreeSpace       int64
+	Verify             VerifyOptions
+	Hooks              hooks.Runner
+	Webhooks           *notify.Notifier
+	DownloadWindow     *schedule.Window
+	OnProgress         func(at time.Time)
+	BookmarkIds        []int
+	SkipScan           bool
+}
+
+type ProfileTag struct {
+	Tag     string
+	Profile string
+}
+
+type ProbeRules struct {
+	Enabled       bool
+	SkipLive      bool
+	SkipPlaylists bool
+}
+
+type VerifyOptions struct {
+	Enabled  bool
+	Checksum bool
+	Retries  int
+}
+
+type MediaTagOptions struct {
+	Enabled  bool
+	Allow    []string
+	Deny     []string
+	Prefix   string
+	MaxCount int
+}
+
+type Outcome string
+
+const (
+	OutcomeArchived    Outcome = "archived"
+	OutcomeSkipped     Outcome = "skipped"
+	OutcomeUnsupported Outcome = "unsupported"
+	OutcomeFailed      Outcome = "failed"
+	OutcomeCancelled   Outcome = "cancelled"
+)
+
+type RunResult struct {
+	Target          string           `json:"target,omitempty"`
+	StartedAt       time.Time        `json:"startedAt"`
+	FinishedAt      time.Time        `json:"finishedAt"`
+	DurationSeconds float64          `json:"durationSeconds"`
+	IsDryRun        bool             `json:"isDryRun"`
+	Error           string           `json:"error,omitempty"`
+	Counts          map[Outcome]int  `json:"counts"`
+	Bookmarks       []BookmarkResult `json:"bookmarks"`
+}
+
+type BookmarkResult struct {
+	BookmarkId        int     `json:"bookmarkId"`
+	Url               string  `json:"url"`
+	Outcome           Outcome `json:"outcome"`
+	Profile           string  `json:"profile,omitempty"`
+	Error             string  `json:"error,omitempty"`
+	AssetIds          []int   `json:"assetIds,omitempty"`
+	UndeletedAssetIds []int   `json:"undeletedAssetIds,omitempty"`
+	BytesUploaded     int64   `json:"bytesUploaded"`
+	DownloadSeconds   float64 `json:"downloadSeconds"`
+	UploadSeconds     float64 `json:"uploadSeconds"`
+	DuplicateOf       int     `json:"duplicateOf,omitempty"`
+
+	bookmark linkding.Bookmark
+	media    *ytdlp.DownloadResult
+	stage    string
+	err      error
+}
+
+// Summarizes a run for webhooks, without the results of the individual bookmarks
+type RunEvent struct {
+	Target          string          `json:"target,omitempty"`
+	StartedAt       time.Time       `json:"startedAt"`
+	FinishedAt      time.Time       `json:"finishedAt,omitzero"`
+	DurationSeconds float64         `json:"durationSeconds,omitempty"`
+	IsDryRun        bool            `json:"isDryRun"`
+	Error           string          `json:"error,omitempty"`
+	Counts          map[Outcome]int `json:"counts,omitempty"`
+}
+
+// Describes the outcome of a bookmark to hooks and webhooks
+type BookmarkEvent struct {
+	Target   string        `json:"target,omitempty"`
+	Outcome  Outcome       `json:"outcome"`
+	Bookmark EventBookmark `json:"bookmark"`
+	Media    *EventMedia   `json:"media,omitempty"`
+	AssetIds []int         `json:"assetIds,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+type EventBookmark struct {
+	Id          int      `json:"id"`
+	Url         string   `json:"url"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+type EventMedia struct {
+	Title        string   `json:"title"`
+	Description  string   `json:"description"`
+	Tags         []string `json:"tags"`
+	Extractor    string   `json:"extractor"`
+	ExtractorKey string   `json:"extractorKey"`
+	Files        []string `json:"files"`
+}
+
+type download struct {
+	result      BookmarkResult
+	media       *ytdlp.DownloadResult
+	key         string
+	duplicateOf int
+	release     func()
 }
@@ -0,0 +1,66 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"linkding-media-archiver/internal/linkding"
+	"os"
+)
+
+var errAssetMismatch = errors.New("uploaded asset doesn't match media file")
+
+// Compares the uploaded asset with the local file, first by size and optionally by streaming both through SHA-256
+func verifyAsset(ctx context.Context, client *linkding.Client, bookmark linkding.Bookmark, asset linkding.Asset, file *os.File, checksum bool) error {
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if asset.FileSize != stat.Size() {
+		return fmt.Errorf("%w: asset is %d bytes, file is %d bytes", errAssetMismatch, asset.FileSize, stat.Size())
+	}
+
+	if !checksum {
+		return nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	fileHash, err := hashReader(file)
+	if err != nil {
+		return err
+	}
+
+	body, err := client.DownloadBookmarkAsset(ctx, bookmark.Id, asset.Id)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	assetHash, err := hashReader(body)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(fileHash, assetHash) {
+		return fmt.Errorf("%w: asset has SHA-256 %x, file has %x", errAssetMismatch, assetHash, fileHash)
+	}
+
+	return nil
+}
+
+func hashReader(reader io.Reader) ([]byte, error) {
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, reader); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
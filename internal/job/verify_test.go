@@ -0,0 +1,108 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"linkding-media-archiver/internal/linkding"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyAsset(t *testing.T) {
+	content := "uploaded content"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/bookmarks/1/assets/2/download/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	client, err := linkding.NewClient(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte("uploaded content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	bookmark := linkding.Bookmark{Id: 1}
+	asset := linkding.Asset{Id: 2, FileSize: int64(len(content))}
+
+	if err := verifyAsset(t.Context(), client, bookmark, asset, file, true); err != nil {
+		t.Errorf("Expected matching asset to be verified, got %v", err)
+	}
+
+	content = "uploaded CONTENT"
+	if err := verifyAsset(t.Context(), client, bookmark, linkding.Asset{Id: 2, FileSize: int64(len(content))}, file, true); !errors.Is(err, errAssetMismatch) {
+		t.Errorf("Expected checksum mismatch, got %v", err)
+	}
+
+	if err := verifyAsset(t.Context(), client, bookmark, linkding.Asset{Id: 2, FileSize: 1}, file, false); !errors.Is(err, errAssetMismatch) {
+		t.Errorf("Expected size mismatch, got %v", err)
+	}
+}
+
+func TestUploadFileKeepsUndeletedAssets(t *testing.T) {
+	content := "uploaded content"
+	uploads := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/bookmarks/1/assets/upload/":
+			uploads++
+
+			// The first upload is truncated, the second one matches the file
+			size := len(content)
+			if uploads == 1 {
+				size = 1
+			}
+
+			fmt.Fprintf(w, `{"id": %d, "asset_type": "upload", "content_type": "video/mp4", "file_size": %d}`, uploads, size)
+		case r.Method == http.MethodDelete:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := linkding.NewClient(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := JobConfiguration{Verify: VerifyOptions{Enabled: true, Retries: 1}}
+	asset, undeleted, _, err := uploadFile(t.Context(), client, linkding.Bookmark{Id: 1}, path, config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if asset.Id != 2 {
+		t.Errorf("Expected second upload to be kept, got asset %d", asset.Id)
+	}
+
+	if len(undeleted) != 1 || undeleted[0].Id != 1 {
+		t.Errorf("Expected mismatched asset 1 to be returned as undeleted, got %v", undeleted)
+	}
+}
@@ -1,10 +1,12 @@
 package linkding
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"log/slog"
+	"linkding-media-archiver/internal/logging"
+	"linkding-media-archiver/internal/metrics"
 	"mime/multipart"
 	"net/http"
 	"net/url"
@@ -14,6 +16,8 @@ import (
 	"time"
 )
 
+var ErrNotFound = errors.New("not found")
+
 func NewClient(baseUrl string, token string) (*Client, error) {
 	if baseUrl == "" {
 		return nil, fmt.Errorf("Linkding base URL is required")
@@ -36,8 +40,8 @@ func NewClient(baseUrl string, token string) (*Client, error) {
 	return &Client{BaseUrl: *parsedUrl, Token: token}, nil
 }
 
-func (client *Client) GetBookmarks(query BookmarksQuery) ([]Bookmark, error) {
-	logger := slog.With("tags", query.Tags, "bundleId", query.BundleId, "modifiedSince", query.ModifiedSince)
+func (client *Client) GetBookmarks(ctx context.Context, query BookmarksQuery) ([]Bookmark, error) {
+	logger := logging.FromContext(ctx).With("tags", query.Tags, "bundleId", query.BundleId, "modifiedSince", query.ModifiedSince)
 	logger.Debug("Fetching bookmarks")
 
 	endpointUrl := client.url("bookmarks/")
@@ -58,7 +62,7 @@ func (client *Client) GetBookmarks(query BookmarksQuery) ([]Bookmark, error) {
 	endpointUrl.RawQuery = queryParams.Encode()
 
 	results, err := getAllItems[Bookmark](endpointUrl, func(u url.URL) (*http.Response, error) {
-		return client.get(u)
+		return client.get(ctx, u)
 	})
 
 	if err == nil {
@@ -68,10 +72,32 @@ func (client *Client) GetBookmarks(query BookmarksQuery) ([]Bookmark, error) {
 	return results, err
 }
 
-func (client *Client) UpdateBookmark(bookmarkId int, update BookmarkUpdate) (*Bookmark, error) {
+func (client *Client) GetBookmark(ctx context.Context, bookmarkId int) (*Bookmark, error) {
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmarkId)
+	logger.Debug("Fetching bookmark")
+
+	endpointUrl := client.url("bookmarks", strconv.Itoa(bookmarkId), "/")
+	resp, err := client.get(ctx, endpointUrl)
+
+	// The bookmark was deleted, or isn't visible to the user of the token
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("bookmark %d: %w", bookmarkId, ErrNotFound)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Fetched bookmark")
+
+	return deserialize[Bookmark](resp)
+}
+
+func (client *Client) UpdateBookmark(ctx context.Context, bookmarkId int, update BookmarkUpdate) (*Bookmark, error) {
 	update.Title = truncateString(update.Title, 512)
 
-	logger := slog.With("bookmarkId", bookmarkId, "update", update)
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmarkId, "update", update)
 	logger.Debug("Updating bookmark")
 
 	endpointUrl := client.url("bookmarks", strconv.Itoa(bookmarkId), "/")
@@ -81,7 +107,7 @@ func (client *Client) UpdateBookmark(bookmarkId int, update BookmarkUpdate) (*Bo
 		return nil, err
 	}
 
-	response, err := client.patchJson(endpointUrl, json)
+	response, err := client.patchJson(ctx, endpointUrl, json)
 
 	if err != nil {
 		return nil, err
@@ -91,29 +117,29 @@ func (client *Client) UpdateBookmark(bookmarkId int, update BookmarkUpdate) (*Bo
 	return deserialize[Bookmark](response)
 }
 
-func (client *Client) GetBookmarkAssets(bookmarkId int) ([]Asset, error) {
-	logger := slog.With("bookmarkId", bookmarkId)
+func (client *Client) GetBookmarkAssets(ctx context.Context, bookmarkId int) ([]Asset, error) {
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmarkId)
 	logger.Debug("Fetching assets for bookmark")
 
 	endpointUrl := client.url("bookmarks", strconv.Itoa(bookmarkId), "assets/")
 
 	results, err := getAllItems[Asset](endpointUrl, func(u url.URL) (*http.Response, error) {
-		return client.get(u)
+		return client.get(ctx, u)
 	})
 
 	if err == nil {
-		slog.Debug("Fetched assets for bookmark", "count", len(results))
+		logging.FromContext(ctx).Debug("Fetched assets for bookmark", "count", len(results))
 	}
 
 	return results, err
 }
 
-func (client *Client) DownloadBookmarkAsset(bookmarkId int, assetId int) (io.ReadCloser, error) {
-	logger := slog.With("bookmarkId", bookmarkId, "assetId", assetId)
+func (client *Client) DownloadBookmarkAsset(ctx context.Context, bookmarkId int, assetId int) (io.ReadCloser, error) {
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmarkId, "assetId", assetId)
 	logger.Debug("Downloading asset content")
 
 	endpointUrl := client.url("bookmarks", strconv.Itoa(bookmarkId), "assets", strconv.Itoa(assetId), "download/")
-	resp, err := client.get(endpointUrl)
+	resp, err := client.get(ctx, endpointUrl)
 
 	if err != nil {
 		return nil, err
@@ -122,8 +148,8 @@ func (client *Client) DownloadBookmarkAsset(bookmarkId int, assetId int) (io.Rea
 	return resp.Body, err
 }
 
-func (client *Client) AddBookmarkAsset(bookmarkId int, file *os.File) (*Asset, error) {
-	logger := slog.With("bookmarkId", bookmarkId)
+func (client *Client) AddBookmarkAsset(ctx context.Context, bookmarkId int, file *os.File) (*Asset, error) {
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmarkId)
 	logger.Debug("Adding asset for bookmark")
 
 	stat, err := file.Stat()
@@ -170,7 +196,12 @@ func (client *Client) AddBookmarkAsset(bookmarkId int, file *os.File) (*Asset, e
 	headers := map[string]string{"Content-Type": formData.FormDataContentType()}
 	contentLength := emptyMultipartPartLength(fieldName, fileName, mimeType, formData.Boundary()) + fileSize
 
-	resp, err := client.send(http.MethodPost, url, headers, readBody, contentLength)
+	var body io.Reader = readBody
+	if client.UploadLimiter != nil {
+		body = client.UploadLimiter.Reader(ctx, readBody)
+	}
+
+	resp, err := client.send(ctx, http.MethodPost, url, headers, body, contentLength)
 
 	if err := errors.Join(err, <-partErr); err != nil {
 		return nil, err
@@ -181,17 +212,41 @@ func (client *Client) AddBookmarkAsset(bookmarkId int, file *os.File) (*Asset, e
 	return deserialize[Asset](resp)
 }
 
-func (client *Client) GetUserProfile() (*UserProfile, error) {
-	slog.Debug("Fetching user profile")
+func (client *Client) DeleteBookmarkAsset(ctx context.Context, bookmarkId int, assetId int) error {
+	logger := logging.FromContext(ctx).With("bookmarkId", bookmarkId, "assetId", assetId)
+	logger.Debug("Deleting asset")
+
+	endpointUrl := client.url("bookmarks", strconv.Itoa(bookmarkId), "assets", strconv.Itoa(assetId)+"/")
+	resp, err := client.send(ctx, http.MethodDelete, endpointUrl, nil, nil, 0)
+
+	// The asset is already gone, for instance because it was deleted by hand
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		logger.Debug("Asset was already deleted")
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+	logger.Debug("Deleted asset")
+
+	return nil
+}
+
+func (client *Client) GetUserProfile(ctx context.Context) (*UserProfile, error) {
+	logging.FromContext(ctx).Debug("Fetching user profile")
 
 	endpointUrl := client.url("user/profile/")
-	resp, err := client.get(endpointUrl)
+	resp, err := client.get(ctx, endpointUrl)
 
 	if err != nil {
 		return nil, err
 	}
 
-	slog.Debug("Fetched user profile")
+	logging.FromContext(ctx).Debug("Fetched user profile")
 
 	return deserialize[UserProfile](resp)
 }
@@ -201,17 +256,17 @@ func (client *Client) url(path ...string) url.URL {
 	return *client.BaseUrl.JoinPath(path...)
 }
 
-func (client *Client) get(url url.URL) (*http.Response, error) {
-	return client.send(http.MethodGet, url, nil, nil, 0)
+func (client *Client) get(ctx context.Context, url url.URL) (*http.Response, error) {
+	return client.send(ctx, http.MethodGet, url, nil, nil, 0)
 }
 
-func (client *Client) patchJson(url url.URL, json io.Reader) (*http.Response, error) {
+func (client *Client) patchJson(ctx context.Context, url url.URL, json io.Reader) (*http.Response, error) {
 	headers := map[string]string{"Content-Type": "application/json"}
-	return client.send(http.MethodPatch, url, headers, json, 0)
+	return client.send(ctx, http.MethodPatch, url, headers, json, 0)
 }
 
-func (client *Client) send(method string, url url.URL, headers map[string]string, body io.Reader, contentLength int64) (*http.Response, error) {
-	req, err := http.NewRequest(method, url.String(), body)
+func (client *Client) send(ctx context.Context, method string, url url.URL, headers map[string]string, body io.Reader, contentLength int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url.String(), body)
 
 	if err != nil {
 		return nil, err
@@ -228,15 +283,19 @@ func (client *Client) send(method string, url url.URL, headers map[string]string
 	req.Close = true // Avoid reusing TCP connections while they're closing
 	req.Header.Set("Authorization", fmt.Sprint("Token ", client.Token))
 
-	logger := slog.With("method", method, "url", url.String())
+	logger := logging.FromContext(ctx).With("method", method, "url", url.String())
 	logger.Debug("Sending HTTP request")
 
+	start := time.Now()
 	resp, err := http.DefaultClient.Do(req)
 
 	if err != nil {
+		metrics.LinkdingDuration.ObserveSince(start, method, "error")
 		return resp, err
 	}
 
+	metrics.LinkdingDuration.ObserveSince(start, method, strconv.Itoa(resp.StatusCode))
+
 	logger = logger.With("statusCode", resp.StatusCode)
 	logger.Debug("Received HTTP response")
 
@@ -29,7 +29,7 @@ func TestGetBookmarksWithTags(t *testing.T) {
 	for _, test := range tests {
 		t.Run(strings.Join(test, ","), func(t *testing.T) {
 			client := getClient(t)
-			bookmarks, err := client.GetBookmarks(BookmarksQuery{Tags: test})
+			bookmarks, err := client.GetBookmarks(t.Context(), BookmarksQuery{Tags: test})
 			check(t, err)
 
 			if len(bookmarks) == 0 {
@@ -51,10 +51,10 @@ func TestGetBookmarksWithTags(t *testing.T) {
 
 func TestGetBookmarksWithBundle(t *testing.T) {
 	client := getClient(t)
-	allBookmarks, err := client.GetBookmarks(BookmarksQuery{})
+	allBookmarks, err := client.GetBookmarks(t.Context(), BookmarksQuery{})
 	check(t, err)
 
-	bookmarks, err := client.GetBookmarks(BookmarksQuery{BundleId: validBundleId})
+	bookmarks, err := client.GetBookmarks(t.Context(), BookmarksQuery{BundleId: validBundleId})
 	check(t, err)
 
 	if !(len(bookmarks) < len(allBookmarks)) {
@@ -71,7 +71,7 @@ func TestGetBookmarksModifiedSince(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.Format(time.DateTime), func(t *testing.T) {
 			client := getClient(t)
-			bookmarks, err := client.GetBookmarks(BookmarksQuery{ModifiedSince: test})
+			bookmarks, err := client.GetBookmarks(t.Context(), BookmarksQuery{ModifiedSince: test})
 			check(t, err)
 
 			if len(bookmarks) == 0 {
@@ -81,10 +81,28 @@ func TestGetBookmarksModifiedSince(t *testing.T) {
 	}
 }
 
+func TestGetBookmark(t *testing.T) {
+	client := getClient(t)
+
+	bookmarks, err := client.GetBookmarks(t.Context(), BookmarksQuery{Tags: []string{validTag}})
+	check(t, err)
+
+	bookmark, err := client.GetBookmark(t.Context(), bookmarks[0].Id)
+	check(t, err)
+
+	if bookmark.Id != bookmarks[0].Id || bookmark.Url != bookmarks[0].Url {
+		t.Errorf("Expected bookmark %d, got %d", bookmarks[0].Id, bookmark.Id)
+	}
+
+	if bookmark.DateModified.IsZero() {
+		t.Error("Expected bookmark to have a modification date")
+	}
+}
+
 func TestUpdateBookmark(t *testing.T) {
 	client := getClient(t)
 
-	bookmarks, err := client.GetBookmarks(BookmarksQuery{Tags: []string{validTag}})
+	bookmarks, err := client.GetBookmarks(t.Context(), BookmarksQuery{Tags: []string{validTag}})
 	check(t, err)
 
 	update := BookmarkUpdate{
@@ -92,7 +110,7 @@ func TestUpdateBookmark(t *testing.T) {
 		Description: fmt.Sprintf("Updated bookmark description %d", time.Now().Unix()),
 	}
 
-	bookmark, err := client.UpdateBookmark(bookmarks[0].Id, update)
+	bookmark, err := client.UpdateBookmark(t.Context(), bookmarks[0].Id, update)
 	check(t, err)
 
 	expectedTitle := string([]rune(update.Title)[:509]) + "..."
@@ -105,14 +123,43 @@ func TestUpdateBookmark(t *testing.T) {
 	}
 }
 
+func TestUpdateBookmarkTags(t *testing.T) {
+	client := getClient(t)
+
+	bookmarks, err := client.GetBookmarks(t.Context(), BookmarksQuery{Tags: []string{validTag}})
+	check(t, err)
+
+	original := bookmarks[0]
+	statusTag := fmt.Sprintf("status-%d", time.Now().Unix())
+	tagNames := append(slices.Clone(original.TagNames), statusTag)
+
+	bookmark, err := client.UpdateBookmark(t.Context(), original.Id, BookmarkUpdate{TagNames: tagNames})
+	check(t, err)
+
+	if !slices.Contains(bookmark.TagNames, statusTag) {
+		t.Errorf("Expected tags to contain %s, was %s", statusTag, strings.Join(bookmark.TagNames, ","))
+	}
+
+	if bookmark.Title != original.Title {
+		t.Errorf("Expected title to be unchanged, was %s", bookmark.Title)
+	}
+
+	bookmark, err = client.UpdateBookmark(t.Context(), original.Id, BookmarkUpdate{TagNames: original.TagNames})
+	check(t, err)
+
+	if slices.Contains(bookmark.TagNames, statusTag) {
+		t.Errorf("Expected tag %s to be removed, was %s", statusTag, strings.Join(bookmark.TagNames, ","))
+	}
+}
+
 func TestGetBookmarkAssets(t *testing.T) {
 	client := getClient(t)
 
-	bookmarks, err := client.GetBookmarks(BookmarksQuery{Tags: []string{validTag}})
+	bookmarks, err := client.GetBookmarks(t.Context(), BookmarksQuery{Tags: []string{validTag}})
 	check(t, err)
 
 	bookmark := bookmarks[0]
-	assets, err := client.GetBookmarkAssets(bookmark.Id)
+	assets, err := client.GetBookmarkAssets(t.Context(), bookmark.Id)
 	check(t, err)
 
 	if len(assets) == 0 {
@@ -135,11 +182,11 @@ func TestAddBookmarkAsset(t *testing.T) {
 	file.Sync()
 	file.Seek(0, 0)
 
-	bookmarks, err := client.GetBookmarks(BookmarksQuery{Tags: []string{validTag}})
+	bookmarks, err := client.GetBookmarks(t.Context(), BookmarksQuery{Tags: []string{validTag}})
 	check(t, err)
 
 	bookmark := bookmarks[0]
-	asset, err := client.AddBookmarkAsset(bookmark.Id, file)
+	asset, err := client.AddBookmarkAsset(t.Context(), bookmark.Id, file)
 	check(t, err)
 
 	if asset.DisplayName != expectedDisplayName {
@@ -150,7 +197,7 @@ func TestAddBookmarkAsset(t *testing.T) {
 		t.Fatalf("Expected content type %s, got %s", expectedContentType, asset.ContentType)
 	}
 
-	download, err := client.DownloadBookmarkAsset(bookmark.Id, asset.Id)
+	download, err := client.DownloadBookmarkAsset(t.Context(), bookmark.Id, asset.Id)
 	check(t, err)
 	defer download.Close()
 
@@ -158,6 +205,37 @@ func TestAddBookmarkAsset(t *testing.T) {
 	check(t, err)
 }
 
+func TestDeleteBookmarkAsset(t *testing.T) {
+	client := getClient(t)
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "test-asset.mp4"))
+	check(t, err)
+	defer file.Close()
+
+	file.Write([]byte("Test content"))
+	file.Sync()
+	file.Seek(0, 0)
+
+	bookmarks, err := client.GetBookmarks(t.Context(), BookmarksQuery{Tags: []string{validTag}})
+	check(t, err)
+
+	bookmark := bookmarks[0]
+	asset, err := client.AddBookmarkAsset(t.Context(), bookmark.Id, file)
+	check(t, err)
+
+	err = client.DeleteBookmarkAsset(t.Context(), bookmark.Id, asset.Id)
+	check(t, err)
+
+	assets, err := client.GetBookmarkAssets(t.Context(), bookmark.Id)
+	check(t, err)
+
+	for _, remaining := range assets {
+		if remaining.Id == asset.Id {
+			t.Fatalf("Expected asset %d to be deleted", asset.Id)
+		}
+	}
+}
+
 func TestAddMultipleBookmarkAssets(t *testing.T) {
 	fileContent := make([]byte, 10_000_000)
 	_, err := rand.Read(fileContent)
@@ -172,7 +250,7 @@ func TestAddMultipleBookmarkAssets(t *testing.T) {
 	file.Close()
 
 	client := getClient(t)
-	bookmarks, err := client.GetBookmarks(BookmarksQuery{Tags: []string{validTag}})
+	bookmarks, err := client.GetBookmarks(t.Context(), BookmarksQuery{Tags: []string{validTag}})
 	check(t, err)
 
 	bookmark := bookmarks[0]
@@ -181,7 +259,7 @@ func TestAddMultipleBookmarkAssets(t *testing.T) {
 		file, err := os.Open(fileName)
 		check(t, err)
 
-		_, err = client.AddBookmarkAsset(bookmark.Id, file)
+		_, err = client.AddBookmarkAsset(t.Context(), bookmark.Id, file)
 		check(t, err)
 
 		file.Close()
@@ -190,7 +268,7 @@ func TestAddMultipleBookmarkAssets(t *testing.T) {
 
 func TestGetUserProfile(t *testing.T) {
 	client := getClient(t)
-	profile, err := client.GetUserProfile()
+	profile, err := client.GetUserProfile(t.Context())
 	check(t, err)
 
 	if len(strings.SplitN(profile.Version, ".", 3)) != 3 {
@@ -1,16 +1,18 @@
 package linkding
 
 import (
+	"linkding-media-archiver/internal/ratelimit"
 	"net/url"
 	"time"
 )
 
 type Bookmark struct {
-	Id          int      `json:"id"`
-	Url         string   `json:"url"`
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	TagNames    []string `json:"tag_names"`
+	Id           int       `json:"id"`
+	Url          string    `json:"url"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	TagNames     []string  `json:"tag_names"`
+	DateModified time.Time `json:"date_modified"`
 }
 
 type Asset struct {
@@ -18,6 +20,7 @@ type Asset struct {
 	AssetType   string `json:"asset_type"`
 	ContentType string `json:"content_type"`
 	DisplayName string `json:"display_name"`
+	FileSize    int64  `json:"file_size"`
 }
 
 type PagedResponse[T any] struct {
@@ -30,6 +33,9 @@ type PagedResponse[T any] struct {
 type Client struct {
 	BaseUrl url.URL
 	Token   string
+
+	// Throttles asset uploads if set
+	UploadLimiter *ratelimit.Limiter
 }
 
 type BookmarksQuery struct {
@@ -38,9 +44,11 @@ type BookmarksQuery struct {
 	ModifiedSince time.Time
 }
 
+// Empty fields are left unchanged, use an empty non-nil slice to remove all tags
 type BookmarkUpdate struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	TagNames    []string `json:"tag_names,omitzero"`
 }
 
 type UserProfile struct {
@@ -1,27 +1,32 @@
 package logging
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
 )
 
 func NewLogger(logLevel string) *slog.Logger {
-	options := slog.HandlerOptions{Level: getLogLevel(logLevel)}
+	level, _ := ParseLevel(logLevel)
+	options := slog.HandlerOptions{Level: level}
 	handler := slog.NewJSONHandler(os.Stdout, &options)
 
 	return slog.New(handler)
 }
 
-func getLogLevel(level string) slog.Level {
-	switch strings.ToUpper(level) {
+// An empty level means INFO
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(level)) {
 	case "DEBUG":
-		return slog.LevelDebug
+		return slog.LevelDebug, nil
+	case "", "INFO":
+		return slog.LevelInfo, nil
 	case "WARN":
-		return slog.LevelWarn
+		return slog.LevelWarn, nil
 	case "ERROR":
-		return slog.LevelError
+		return slog.LevelError, nil
 	default:
-		return slog.LevelInfo
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q, expected DEBUG, INFO, WARN or ERROR", level)
 	}
 }
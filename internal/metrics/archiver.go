@@ -0,0 +1,14 @@
+package metrics
+
+var (
+	BookmarksProcessed = NewCounter("ldma_bookmarks_processed_total", "Bookmarks processed by target and outcome.", "target", "outcome")
+	BookmarksFailed    = NewCounter("ldma_bookmarks_failed_total", "Bookmarks that failed by target and the stage they failed in.", "target", "stage")
+	DownloadedBytes    = NewCounter("ldma_downloaded_bytes_total", "Bytes of media downloaded with yt-dlp by target.", "target")
+	UploadedBytes      = NewCounter("ldma_uploaded_bytes_total", "Bytes of media uploaded to Linkding by target.", "target")
+
+	YtdlpDuration    = NewHistogram("ldma_ytdlp_duration_seconds", "Duration of yt-dlp runs by operation and result.", DefaultBuckets, "operation", "result")
+	LinkdingDuration = NewHistogram("ldma_linkding_request_duration_seconds", "Duration of Linkding API requests by method and status code.", DefaultBuckets, "method", "status")
+
+	LastSuccessfulScan = NewGauge("ldma_last_successful_scan_timestamp_seconds", "Unix time of the last scan that processed all bookmarks of a target.", "target")
+	QueueLength        = NewGauge("ldma_queue_length", "Bookmarks waiting in the download and upload queues.", "queue")
+)
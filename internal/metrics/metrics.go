@@ -0,0 +1,215 @@
+package metrics
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Durations from quick API requests up to downloads of long videos
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 1800, 3600}
+
+var (
+	registryMutex sync.Mutex
+	registry      []metric
+)
+
+func NewCounter(name string, help string, labelNames ...string) *Counter {
+	counter := &Counter{vector{name: name, help: help, kind: "counter", labelNames: labelNames, series: map[string]*series{}}}
+	register(counter)
+	return counter
+}
+
+func NewGauge(name string, help string, labelNames ...string) *Gauge {
+	gauge := &Gauge{vector{name: name, help: help, kind: "gauge", labelNames: labelNames, series: map[string]*series{}}}
+	register(gauge)
+	return gauge
+}
+
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	histogram := &Histogram{name: name, help: help, labelNames: labelNames, buckets: buckets, series: map[string]*histogramSeries{}}
+	register(histogram)
+	return histogram
+}
+
+func register(metric metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry = append(registry, metric)
+}
+
+// Serves all metrics in the Prometheus text exposition format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(Format()))
+	})
+}
+
+func Format() string {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	builder := new(strings.Builder)
+
+	for _, metric := range registry {
+		metric.write(builder)
+	}
+
+	return builder.String()
+}
+
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+func (counter *Counter) Add(value float64, labelValues ...string) {
+	counter.update(labelValues, func(current float64) float64 { return current + value })
+}
+
+func (gauge *Gauge) Set(value float64, labelValues ...string) {
+	gauge.update(labelValues, func(float64) float64 { return value })
+}
+
+func (gauge *Gauge) SetToCurrentTime(labelValues ...string) {
+	gauge.Set(float64(time.Now().UnixNano())/1e9, labelValues...)
+}
+
+func (histogram *Histogram) Observe(value float64, labelValues ...string) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	key := seriesKey(histogram.labelNames, labelValues)
+	entry, ok := histogram.series[key]
+
+	if !ok {
+		entry = &histogramSeries{labelValues: slices.Clone(labelValues), counts: make([]uint64, len(histogram.buckets))}
+		histogram.series[key] = entry
+	}
+
+	for i, bound := range histogram.buckets {
+		if value <= bound {
+			entry.counts[i]++
+		}
+	}
+
+	entry.sum += value
+	entry.count++
+}
+
+func (histogram *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	histogram.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (vector *vector) update(labelValues []string, update func(float64) float64) {
+	vector.mutex.Lock()
+	defer vector.mutex.Unlock()
+
+	key := seriesKey(vector.labelNames, labelValues)
+	entry, ok := vector.series[key]
+
+	if !ok {
+		entry = &series{labelValues: slices.Clone(labelValues)}
+		vector.series[key] = entry
+	}
+
+	entry.value = update(entry.value)
+}
+
+func (vector *vector) write(builder *strings.Builder) {
+	vector.mutex.Lock()
+	defer vector.mutex.Unlock()
+
+	writeHeader(builder, vector.name, vector.help, vector.kind)
+
+	for _, key := range sortedKeys(vector.series) {
+		entry := vector.series[key]
+		fmt.Fprintf(builder, "%s%s %s\n", vector.name, formatLabels(vector.labelNames, entry.labelValues), formatValue(entry.value))
+	}
+}
+
+func (histogram *Histogram) write(builder *strings.Builder) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	writeHeader(builder, histogram.name, histogram.help, "histogram")
+	bucketLabels := append(slices.Clone(histogram.labelNames), "le")
+
+	for _, key := range sortedKeys(histogram.series) {
+		entry := histogram.series[key]
+
+		for i, bound := range histogram.buckets {
+			labels := formatLabels(bucketLabels, append(slices.Clone(entry.labelValues), formatValue(bound)))
+			fmt.Fprintf(builder, "%s_bucket%s %d\n", histogram.name, labels, entry.counts[i])
+		}
+
+		labels := formatLabels(bucketLabels, append(slices.Clone(entry.labelValues), "+Inf"))
+		fmt.Fprintf(builder, "%s_bucket%s %d\n", histogram.name, labels, entry.count)
+
+		labels = formatLabels(histogram.labelNames, entry.labelValues)
+		fmt.Fprintf(builder, "%s_sum%s %s\n", histogram.name, labels, formatValue(entry.sum))
+		fmt.Fprintf(builder, "%s_count%s %d\n", histogram.name, labels, entry.count)
+	}
+}
+
+// The exposition format is UTF-8, so invalid bytes from sources like media metadata are replaced
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+func writeHeader(builder *strings.Builder, name string, help string, kind string) {
+	fmt.Fprintf(builder, "# HELP %s %s\n", name, helpEscaper.Replace(strings.ToValidUTF8(help, "\uFFFD")))
+	fmt.Fprintf(builder, "# TYPE %s %s\n", name, kind)
+}
+
+// Missing label values are empty, so a mismatch with the label names can't produce invalid output.
+// Values are quoted so that no value, whatever it contains, can run into the next one.
+func seriesKey(labelNames []string, labelValues []string) string {
+	values := make([]string, len(labelNames))
+	copy(values, labelValues)
+
+	for i, value := range values {
+		values[i] = strconv.Quote(value)
+	}
+
+	return strings.Join(values, ",")
+}
+
+func formatLabels(labelNames []string, labelValues []string) string {
+	if len(labelNames) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(labelNames))
+
+	for i, name := range labelNames {
+		value := ""
+		if i < len(labelValues) {
+			value = labelValues[i]
+		}
+
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(strings.ToValidUTF8(value, "\uFFFD")))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[T any](series map[string]T) []string {
+	return slices.Sorted(maps.Keys(series))
+}
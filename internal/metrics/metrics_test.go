@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFormat(t *testing.T) {
+	counter := NewCounter("test_requests_total", "Requests by method.", "method")
+	counter.Inc("GET")
+	counter.Add(2, "GET")
+	counter.Inc(`PO"ST`)
+
+	gauge := NewGauge("test_queue_length", "Queue length.")
+	gauge.Set(4)
+
+	histogram := NewHistogram("test_duration_seconds", "Duration.", []float64{1, 5}, "operation")
+	histogram.Observe(0.5, "probe")
+	histogram.Observe(3, "probe")
+	histogram.Observe(10, "probe")
+
+	output := Format()
+	expected := []string{
+		"# HELP test_requests_total Requests by method.\n# TYPE test_requests_total counter\n",
+		`test_requests_total{method="GET"} 3` + "\n",
+		`test_requests_total{method="PO\"ST"} 1` + "\n",
+		"# TYPE test_queue_length gauge\ntest_queue_length 4\n",
+		"# TYPE test_duration_seconds histogram\n",
+		`test_duration_seconds_bucket{operation="probe",le="1"} 1` + "\n",
+		`test_duration_seconds_bucket{operation="probe",le="5"} 2` + "\n",
+		`test_duration_seconds_bucket{operation="probe",le="+Inf"} 3` + "\n",
+		`test_duration_seconds_sum{operation="probe"} 13.5` + "\n",
+		`test_duration_seconds_count{operation="probe"} 3` + "\n",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+}
+
+func TestFormatEscaping(t *testing.T) {
+	counter := NewCounter("test_escaped_total", "Help with a \\ backslash\nand a second line.", "target", "outcome")
+	counter.Inc(`back\slash`, `"quoted"`)
+	counter.Inc("two\nlines", "invalid \xff byte")
+
+	// Values that would run into each other if they were simply joined
+	counter.Inc("a\xff", "b")
+	counter.Inc("a", "\xffb")
+
+	output := Format()
+	expected := []string{
+		"# HELP test_escaped_total Help with a \\\\ backslash\\nand a second line.\n",
+		`test_escaped_total{target="back\\slash",outcome="\"quoted\""} 1` + "\n",
+		`test_escaped_total{target="two\nlines",outcome="invalid ` + "�" + ` byte"} 1` + "\n",
+		`test_escaped_total{target="a` + "�" + `",outcome="b"} 1` + "\n",
+		`test_escaped_total{target="a",outcome="` + "�" + `b"} 1` + "\n",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+
+	sample := regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*(\{([a-zA-Z_][a-zA-Z0-9_]*="([^"\\\n]|\\[\\"n])*",?)*\})? \S+$`)
+
+	for line := range strings.Lines(output) {
+		line = strings.TrimSuffix(line, "\n")
+
+		if !utf8.ValidString(line) || !strings.HasPrefix(line, "# ") && !sample.MatchString(line) {
+			t.Errorf("Expected a valid line, got %q", line)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+type metric interface {
+	write(builder *strings.Builder)
+}
+
+type Counter struct {
+	vector
+}
+
+type Gauge struct {
+	vector
+}
+
+type Histogram struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+
+	mutex  sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// Values by label values, shared by counters and gauges
+type vector struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+}
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"linkding-media-archiver/internal/logging"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	EventRunStarted       = "run.started"
+	EventBookmarkArchived = "bookmark.archived"
+	EventBookmarkFailed   = "bookmark.failed"
+	EventRunFinished      = "run.finished"
+)
+
+const SignatureHeader = "X-LDMA-Signature"
+const EventHeader = "X-LDMA-Event"
+
+const requestTimeout = 10 * time.Second
+const initialRetryDelay = time.Second
+
+func NewNotifier(urls []string, secret string, retries int) *Notifier {
+	return &Notifier{Urls: urls, Secret: secret, Retries: retries, client: &http.Client{Timeout: requestTimeout}}
+}
+
+// Delivers the event to every URL, logging failures instead of returning them so a broken receiver never fails a run
+func (notifier *Notifier) Notify(ctx context.Context, eventType string, data any) {
+	if notifier == nil || len(notifier.Urls) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(Event{Type: eventType, Time: time.Now(), Data: data})
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to serialize webhook event", "event", eventType, "error", err)
+		return
+	}
+
+	for _, endpoint := range notifier.Urls {
+		logger := logging.FromContext(ctx).With("event", eventType, "host", host(endpoint))
+
+		if err := notifier.deliver(ctx, endpoint, eventType, body); err != nil {
+			logger.Error("Failed to deliver webhook", "error", err)
+			continue
+		}
+
+		logger.Debug("Delivered webhook")
+	}
+}
+
+// Delivers the event in the background, so unreachable receivers don't hold up the caller
+func (notifier *Notifier) Go(ctx context.Context, eventType string, data any) {
+	if notifier == nil || len(notifier.Urls) == 0 {
+		return
+	}
+
+	notifier.pending.Go(func() {
+		notifier.Notify(ctx, eventType, data)
+	})
+}
+
+// Waits for the events delivered in the background, and returns false if they didn't finish within the timeout
+func (notifier *Notifier) Wait(timeout time.Duration) bool {
+	if notifier == nil {
+		return true
+	}
+
+	done := make(chan struct{})
+	go func() {
+		notifier.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Retries with an increasing delay on network errors and server errors, but not on other client errors
+func (notifier *Notifier) deliver(ctx context.Context, endpoint string, eventType string, body []byte) error {
+	delay := initialRetryDelay
+
+	for attempt := 0; ; attempt++ {
+		isRetryable, err := notifier.send(ctx, endpoint, eventType, body)
+
+		if err == nil || !isRetryable || attempt >= notifier.Retries {
+			return err
+		}
+
+		logging.FromContext(ctx).Warn("Webhook delivery failed, retrying", "event", eventType, "host", host(endpoint), "attempt", attempt+1, "delay", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+func (notifier *Notifier) send(ctx context.Context, endpoint string, eventType string, body []byte) (isRetryable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("invalid webhook URL for %s", host(endpoint))
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+
+	if notifier.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(notifier.Secret, body))
+	}
+
+	resp, err := notifier.client.Do(req)
+	if err != nil {
+		// The error includes the URL, which may contain a token
+		if urlErr, ok := err.(*url.Error); ok {
+			urlErr.URL = req.URL.Host
+		}
+
+		return ctx.Err() == nil, err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		isRetryable = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return isRetryable, fmt.Errorf("expected success status code, was %s", resp.Status)
+	}
+
+	return false, nil
+}
+
+// Webhook URLs often contain tokens, so only their host is logged
+func host(endpoint string) string {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "invalid URL"
+	}
+
+	return parsed.Host
+}
+
+// Returns the hex encoded HMAC-SHA256 of the body, for receivers to compare with the signature header
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
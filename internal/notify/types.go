@@ -0,0 +1,23 @@
+package notify
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Posts events as JSON to every URL, signed with an HMAC-SHA256 of the body if a secret is set
+type Notifier struct {
+	Urls    []string
+	Secret  string
+	Retries int
+
+	client  *http.Client
+	pending sync.WaitGroup
+}
+
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
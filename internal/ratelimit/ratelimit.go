@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Reads are split into chunks of at most this size, so concurrent readers take turns
+const maxChunkSize = 32 * 1024
+
+// The first window containing the time applies, otherwise the default rate
+func (schedule Schedule) At(t time.Time) int64 {
+	for _, windowRate := range schedule.Windows {
+		if isWithin, _ := windowRate.Window.Contains(t); isWithin {
+			return windowRate.Rate
+		}
+	}
+
+	return schedule.Default
+}
+
+func (schedule Schedule) IsSet() bool {
+	return schedule.Default > 0 || len(schedule.Windows) > 0
+}
+
+func NewLimiter(schedule Schedule) *Limiter {
+	return &Limiter{Schedule: schedule}
+}
+
+// Blocks until n bytes may pass, allowing bursts of up to one second of the current rate
+func (limiter *Limiter) WaitN(ctx context.Context, n int) error {
+	wait := limiter.reserve(n, time.Now())
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Takes the tokens right away even if that leaves the bucket in debt, and returns how long to wait for the debt to be paid
+func (limiter *Limiter) reserve(n int, now time.Time) time.Duration {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	rate := float64(limiter.Schedule.At(now))
+
+	if rate <= 0 {
+		limiter.tokens, limiter.lastRefill = 0, time.Time{}
+		return 0
+	}
+
+	if limiter.lastRefill.IsZero() {
+		limiter.tokens = rate
+	} else {
+		limiter.tokens = min(rate, limiter.tokens+now.Sub(limiter.lastRefill).Seconds()*rate)
+	}
+
+	limiter.lastRefill = now
+	limiter.tokens -= float64(n)
+
+	if limiter.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-limiter.tokens / rate * float64(time.Second))
+}
+
+// Wraps the reader so its throughput counts against the limiter
+func (limiter *Limiter) Reader(ctx context.Context, reader io.Reader) io.Reader {
+	return &limitedReader{ctx: ctx, limiter: limiter, reader: reader}
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	limiter *Limiter
+	reader  io.Reader
+}
+
+func (reader *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > maxChunkSize {
+		p = p[:maxChunkSize]
+	}
+
+	n, err := reader.reader.Read(p)
+
+	if n > 0 {
+		if waitErr := reader.limiter.WaitN(reader.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
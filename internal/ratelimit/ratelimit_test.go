@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"bytes"
+	"io"
+	"linkding-media-archiver/internal/schedule"
+	"testing"
+	"time"
+)
+
+func TestScheduleAt(t *testing.T) {
+	night, err := schedule.ParseWindow("01:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rates := Schedule{Default: 1024, Windows: []WindowRate{{Window: night, Rate: 0}}}
+
+	if rate := rates.At(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)); rate != 1024 {
+		t.Errorf("Expected default rate during the day, got %d", rate)
+	}
+
+	if rate := rates.At(time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC)); rate != 0 {
+		t.Errorf("Expected unlimited rate at night, got %d", rate)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	limiter := NewLimiter(Schedule{Default: 1000})
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if wait := limiter.reserve(1000, now); wait != 0 {
+		t.Errorf("Expected an initial burst of one second to pass, waited %s", wait)
+	}
+
+	if wait := limiter.reserve(500, now); wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait for the tokens to refill, waited %s", wait)
+	}
+
+	if wait := limiter.reserve(500, now.Add(time.Second)); wait != 0 {
+		t.Errorf("Expected refilled tokens to pass, waited %s", wait)
+	}
+}
+
+func TestReader(t *testing.T) {
+	limiter := NewLimiter(Schedule{Default: 100_000})
+	content := bytes.Repeat([]byte("a"), 150_000)
+
+	start := time.Now()
+	read, err := io.ReadAll(limiter.Reader(t.Context(), bytes.NewReader(content)))
+	elapsed := time.Since(start)
+
+	if err != nil || len(read) != len(content) {
+		t.Fatalf("Expected to read all content, got %d bytes and %v", len(read), err)
+	}
+
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("Expected reading to be throttled, took %s", elapsed)
+	}
+}
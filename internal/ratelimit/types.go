@@ -0,0 +1,27 @@
+package ratelimit
+
+import (
+	"linkding-media-archiver/internal/schedule"
+	"sync"
+	"time"
+)
+
+// A rate in bytes per second that may depend on the time of day, where zero means unlimited
+type Schedule struct {
+	Default int64
+	Windows []WindowRate
+}
+
+type WindowRate struct {
+	Window *schedule.Window
+	Rate   int64
+}
+
+// A token bucket shared by everything it limits, so the rate applies to their combined throughput
+type Limiter struct {
+	Schedule Schedule
+
+	mutex      sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+}
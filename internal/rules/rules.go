@@ -0,0 +1,88 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Parses a JSON array of rules
+func Parse(value string) (Rules, error) {
+	var rules Rules
+
+	if strings.TrimSpace(value) == "" {
+		return rules, nil
+	}
+
+	// Unknown fields are most likely typos, which would otherwise be ignored silently
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, err
+	}
+
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+
+	return rules, nil
+}
+
+func (rules Rules) Match(rawUrl string) (Rule, bool) {
+	parsedUrl, err := url.Parse(rawUrl)
+
+	if err != nil {
+		return Rule{}, false
+	}
+
+	host := strings.ToLower(parsedUrl.Hostname())
+
+	for _, rule := range rules {
+		if rule.matches(host) {
+			return rule, true
+		}
+	}
+
+	return Rule{}, false
+}
+
+func (rule *Rule) compile() error {
+	if len(rule.Hosts) == 0 && rule.HostRegex == "" {
+		return fmt.Errorf("either hosts or hostRegex is required")
+	}
+
+	for _, host := range rule.Hosts {
+		if _, err := path.Match(host, ""); err != nil {
+			return fmt.Errorf("invalid host pattern %s: %w", host, err)
+		}
+	}
+
+	if rule.HostRegex != "" {
+		regex, err := regexp.Compile(rule.HostRegex)
+
+		if err != nil {
+			return fmt.Errorf("invalid host regex %s: %w", rule.HostRegex, err)
+		}
+
+		rule.hostRegex = regex
+	}
+
+	return nil
+}
+
+// Hosts are glob patterns such as *.youtube.com, where * also matches dots
+func (rule Rule) matches(host string) bool {
+	for _, pattern := range rule.Hosts {
+		if matched, _ := path.Match(strings.ToLower(pattern), host); matched {
+			return true
+		}
+	}
+
+	return rule.hostRegex != nil && rule.hostRegex.MatchString(host)
+}
@@ -0,0 +1,75 @@
+package rules
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	rules, err := Parse(`[
+		{"hosts": ["youtube.com", "*.youtube.com", "youtu.be"], "format": "best[height<=720][ext=mp4]"},
+		{"hostRegex": "^(.+\\.)?(soundcloud|bandcamp)\\.com$", "format": "bestaudio", "updateBookmarkText": false},
+		{"hosts": ["*"], "args": ["--cookies", "/data/cookies.txt"]}
+	]`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(rules))
+	}
+
+	if rules[1].UpdateBookmarkText == nil || *rules[1].UpdateBookmarkText {
+		t.Error("Expected second rule to disable updating bookmark text")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		`{"hosts": ["youtube.com"]}`,
+		`[{"format": "best"}]`,
+		`[{"hosts": ["[youtube.com"]}]`,
+		`[{"hostRegex": "(youtube"}]`,
+		`[{"hosts": ["youtube.com"], "fromat": "best"}]`,
+	}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			if _, err := Parse(test); err == nil {
+				t.Error("Expected rules to be invalid")
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rules, err := Parse(`[
+		{"hosts": ["youtube.com", "*.youtube.com", "youtu.be"], "format": "youtube"},
+		{"hostRegex": "^(.+\\.)?(soundcloud|bandcamp)\\.com$", "format": "audio"}
+	]`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://www.youtube.com/watch?v=RWGTIIO2QiQ", "youtube"},
+		{"https://YouTube.com/watch?v=RWGTIIO2QiQ", "youtube"},
+		{"https://youtu.be/RWGTIIO2QiQ", "youtube"},
+		{"https://soundcloud.com/artist/song", "audio"},
+		{"https://artist.bandcamp.com/track/song", "audio"},
+		{"https://notyoutube.com/watch", ""},
+		{"https://example.com/soundcloud.com", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			rule, ok := rules.Match(test.url)
+
+			if ok != (test.expected != "") || rule.Format != test.expected {
+				t.Errorf("Expected rule with format %q, got %q (matched: %t)", test.expected, rule.Format, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package rules
+
+import "regexp"
+
+// Empty fields fall back to the global configuration
+type Rule struct {
+	Hosts              []string `json:"hosts"`
+	HostRegex          string   `json:"hostRegex"`
+	Format             string   `json:"format"`
+	FormatSort         string   `json:"formatSort"`
+	Args               []string `json:"args"`
+	RateLimit          string   `json:"rateLimit"`
+	UpdateBookmarkText *bool    `json:"updateBookmarkText"`
+
+	hostRegex *regexp.Regexp
+}
+
+// The first matching rule applies
+type Rules []Rule
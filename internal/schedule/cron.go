@@ -0,0 +1,190 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	minuteField     = field{"minute", 0, 59}
+	hourField       = field{"hour", 0, 23}
+	dayOfMonthField = field{"day of month", 1, 31}
+	monthField      = field{"month", 1, 12}
+	dayOfWeekField  = field{"day of week", 0, 7}
+)
+
+// Runs are searched for this far ahead, which covers expressions like February 29th
+const maxLookahead = 5 * 366 * 24 * time.Hour
+
+// Covers every length of month and the days of the week
+const periodLookahead = 366 * 24 * time.Hour
+
+// Parses an expression such as "*/15 * * * *", with lists, ranges and steps in every field
+func ParseCron(expression string) (*Cron, error) {
+	fields := strings.Fields(expression)
+
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in cron expression, got %d", len(fields))
+	}
+
+	cron := &Cron{
+		expression:             strings.Join(fields, " "),
+		isDayOfMonthRestricted: fields[2] != "*",
+		isDayOfWeekRestricted:  fields[4] != "*",
+	}
+
+	parsers := []struct {
+		value  string
+		field  field
+		values []bool
+	}{
+		{fields[0], minuteField, cron.minutes[:]},
+		{fields[1], hourField, cron.hours[:]},
+		{fields[2], dayOfMonthField, cron.daysOfMonth[:]},
+		{fields[3], monthField, cron.months[:]},
+	}
+
+	for _, parser := range parsers {
+		if err := parseField(parser.value, parser.field, parser.values); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sunday is both 0 and 7
+	var daysOfWeek [8]bool
+	if err := parseField(fields[4], dayOfWeekField, daysOfWeek[:]); err != nil {
+		return nil, err
+	}
+
+	copy(cron.daysOfWeek[:], daysOfWeek[:7])
+	cron.daysOfWeek[0] = cron.daysOfWeek[0] || daysOfWeek[7]
+
+	return cron, nil
+}
+
+func parseField(value string, field field, values []bool) error {
+	for part := range strings.SplitSeq(value, ",") {
+		if err := parsePart(part, field, values); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", field.name, part, err)
+		}
+	}
+
+	return nil
+}
+
+func parsePart(part string, field field, values []bool) error {
+	rangePart, stepPart, hasStep := strings.Cut(part, "/")
+	step := 1
+
+	if hasStep {
+		parsed, err := strconv.Atoi(stepPart)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("step must be a positive number")
+		}
+
+		step = parsed
+	}
+
+	start, end := field.min, field.max
+
+	if rangePart != "*" {
+		startPart, endPart, isRange := strings.Cut(rangePart, "-")
+
+		var err error
+		if start, err = parseValue(startPart, field); err != nil {
+			return err
+		}
+
+		end = start
+		if isRange {
+			if end, err = parseValue(endPart, field); err != nil {
+				return err
+			}
+		} else if hasStep {
+			end = field.max
+		}
+
+		if end < start {
+			return fmt.Errorf("range end is before its start")
+		}
+	}
+
+	for value := start; value <= end; value += step {
+		values[value] = true
+	}
+
+	return nil
+}
+
+func parseValue(value string, field field) (int, error) {
+	parsed, err := strconv.Atoi(value)
+
+	if err != nil || parsed < field.min || parsed > field.max {
+		return 0, fmt.Errorf("value must be a number from %d to %d", field.min, field.max)
+	}
+
+	return parsed, nil
+}
+
+func (cron *Cron) String() string {
+	return cron.expression
+}
+
+// Returns the first matching minute after the given time, or the zero time if there is none
+func (cron *Cron) Next(after time.Time) time.Time {
+	next := after.Truncate(time.Minute).Add(time.Minute)
+	limit := next.Add(maxLookahead)
+
+	for next.Before(limit) {
+		year, month, day := next.Date()
+		location := next.Location()
+
+		switch {
+		case !cron.months[month]:
+			next = time.Date(year, month+1, 1, 0, 0, 0, 0, location)
+		case !cron.matchesDay(next):
+			next = time.Date(year, month, day+1, 0, 0, 0, 0, location)
+		case !cron.hours[next.Hour()]:
+			next = time.Date(year, month, day, next.Hour()+1, 0, 0, 0, location)
+		case !cron.minutes[next.Minute()]:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+
+	return time.Time{}
+}
+
+// Returns the longest time between runs within a year, as uneven expressions such as "0 9,10 * * *" have both short and long gaps
+func (cron *Cron) longestGap(after time.Time) time.Duration {
+	var longest time.Duration
+	limit := after.Add(periodLookahead)
+	previous := cron.Next(after)
+
+	// Expressions matching less than once a year, such as on February 29, still have one gap
+	for !previous.IsZero() && (longest == 0 || previous.Before(limit)) {
+		next := cron.Next(previous)
+		if next.IsZero() {
+			break
+		}
+
+		longest = max(longest, next.Sub(previous))
+		previous = next
+	}
+
+	return longest
+}
+
+func (cron *Cron) matchesDay(t time.Time) bool {
+	dayOfMonth := cron.daysOfMonth[t.Day()]
+	dayOfWeek := cron.daysOfWeek[t.Weekday()]
+
+	if cron.isDayOfMonthRestricted && cron.isDayOfWeekRestricted {
+		return dayOfMonth || dayOfWeek
+	}
+
+	return dayOfMonth && dayOfWeek
+}
@@ -0,0 +1,81 @@
+package schedule
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Returns when the next run is planned after the given time
+func (scheduler Scheduler) Next(after time.Time) time.Time {
+	if scheduler.Cron != nil {
+		return scheduler.Cron.Next(after)
+	}
+
+	return after.Add(scheduler.Interval)
+}
+
+// Returns the longest time runs may be apart, such as for telling whether runs stopped happening
+func (scheduler Scheduler) Period(now time.Time) time.Duration {
+	period := scheduler.Interval
+
+	if scheduler.Cron != nil {
+		period = scheduler.Cron.longestGap(now)
+	}
+
+	// Runs outside the window are postponed until it opens again the next day
+	if scheduler.Window != nil {
+		period = max(period, day)
+	}
+
+	return period
+}
+
+// Blocks until downloads are allowed, and returns false if ctx was cancelled while waiting
+func (scheduler Scheduler) WaitForWindow(ctx context.Context) bool {
+	if scheduler.Window == nil {
+		return true
+	}
+
+	now := time.Now()
+	start := scheduler.Window.NextStart(now)
+
+	if !start.After(now) {
+		return true
+	}
+
+	slog.Info("Waiting for download window", "window", scheduler.Window.String(), "windowStart", start)
+	timer := time.NewTimer(start.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Returns a context that is cancelled when the current download window ends, stopping the downloads like a shutdown would
+func (scheduler Scheduler) WindowContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	if scheduler.Window == nil {
+		return ctx, cancel
+	}
+
+	isWithin, end := scheduler.Window.Contains(time.Now())
+	if !isWithin {
+		return ctx, cancel
+	}
+
+	timer := time.AfterFunc(time.Until(end), func() {
+		slog.Info("Download window ended", "window", scheduler.Window.String())
+		cancel()
+	})
+
+	return ctx, func() {
+		timer.Stop()
+		cancel()
+	}
+}
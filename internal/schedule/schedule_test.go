@@ -0,0 +1,133 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	invalid := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"}
+
+	for _, expression := range invalid {
+		if _, err := ParseCron(expression); err == nil {
+			t.Errorf("Expected error for %q", expression)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	after := time.Date(2025, 1, 31, 10, 7, 30, 0, time.UTC) // Friday
+
+	tests := []struct {
+		expression string
+		expected   time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 31, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 31, 10, 15, 0, 0, time.UTC)},
+		{"0 1-6 * * *", time.Date(2025, 2, 1, 1, 0, 0, 0, time.UTC)},
+		{"30 9,17 * * *", time.Date(2025, 1, 31, 17, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 1", time.Date(2025, 2, 3, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2025, 2, 2, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 6", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)}, // Day of month or day of week
+	}
+
+	for _, test := range tests {
+		cron, err := ParseCron(test.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if next := cron.Next(after); !next.Equal(test.expected) {
+			t.Errorf("Expected next run of %q at %s, got %s", test.expression, test.expected, next)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2025, 1, 31, hour, minute, 0, 0, time.UTC)
+	}
+
+	night, err := ParseWindow("22:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	morning, err := ParseWindow("01:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		window        *Window
+		time          time.Time
+		isWithin      bool
+		expectedEnd   time.Time
+		expectedStart time.Time
+	}{
+		{morning, at(3, 0), true, at(6, 0), at(3, 0)},
+		{morning, at(0, 30), false, time.Time{}, at(1, 0)},
+		{morning, at(7, 0), false, time.Time{}, at(1, 0).AddDate(0, 0, 1)},
+		{night, at(23, 0), true, at(6, 0).AddDate(0, 0, 1), at(23, 0)},
+		{night, at(2, 0), true, at(6, 0), at(2, 0)},
+		{night, at(12, 0), false, time.Time{}, at(22, 0)},
+	}
+
+	for _, test := range tests {
+		isWithin, end := test.window.Contains(test.time)
+
+		if isWithin != test.isWithin || !end.Equal(test.expectedEnd) {
+			t.Errorf("Expected %s to contain %s: %t until %s, got %t until %s", test.window, test.time, test.isWithin, test.expectedEnd, isWithin, end)
+		}
+
+		if start := test.window.NextStart(test.time); !start.Equal(test.expectedStart) {
+			t.Errorf("Expected %s to start at %s after %s, got %s", test.window, test.expectedStart, test.time, start)
+		}
+	}
+
+	for _, value := range []string{"01:00", "25:00-06:00", "01:00-01:00"} {
+		if _, err := ParseWindow(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
+
+func TestSchedulerPeriod(t *testing.T) {
+	now := time.Date(2025, 1, 31, 8, 0, 0, 0, time.UTC)
+
+	window, err := ParseWindow("01:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expression string
+		interval   time.Duration
+		window     *Window
+		expected   time.Duration
+	}{
+		{"", time.Hour, nil, time.Hour},
+		{"", time.Hour, window, 24 * time.Hour},
+		{"*/15 * * * *", 0, nil, 15 * time.Minute},
+		{"0 9,10 * * *", 0, nil, 23 * time.Hour}, // From 10:00 to 9:00 the next day, not from 9:00 to 10:00
+		{"0 12 * * 1,2", 0, nil, 6 * 24 * time.Hour},
+		{"0 0 1 * *", 0, nil, 31 * 24 * time.Hour},
+		{"0 0 29 2 *", 0, nil, (4*365 + 1) * 24 * time.Hour},
+	}
+
+	for _, test := range tests {
+		scheduler := Scheduler{Interval: test.interval, Window: test.window}
+
+		if test.expression != "" {
+			if scheduler.Cron, err = ParseCron(test.expression); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if period := scheduler.Period(now); period != test.expected {
+			t.Errorf("Expected a period of %s for %q, got %s", test.expected, test.expression, period)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package schedule
+
+import "time"
+
+// A cron expression with the five standard fields: minute, hour, day of month, month and day of week
+type Cron struct {
+	expression string
+
+	minutes     [60]bool
+	hours       [24]bool
+	daysOfMonth [32]bool
+	months      [13]bool
+	daysOfWeek  [7]bool
+
+	// Days match either field when both are restricted, as in standard cron
+	isDayOfMonthRestricted bool
+	isDayOfWeekRestricted  bool
+}
+
+// A daily time range in local time, which may wrap around midnight
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Plans runs either by cron expression or at a fixed interval, optionally restricted to a download window
+type Scheduler struct {
+	Cron     *Cron
+	Interval time.Duration
+	Window   *Window
+}
+
+type field struct {
+	name string
+	min  int
+	max  int
+}
@@ -0,0 +1,95 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// Parses a range such as "01:00-06:00", or "22:00-06:00" for a window that spans midnight
+func ParseWindow(value string) (*Window, error) {
+	startPart, endPart, ok := strings.Cut(value, "-")
+	if !ok {
+		return nil, fmt.Errorf("expected window in the format HH:MM-HH:MM, got %q", value)
+	}
+
+	start, err := parseTimeOfDay(startPart)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseTimeOfDay(endPart)
+	if err != nil {
+		return nil, err
+	}
+
+	if start == end {
+		return nil, fmt.Errorf("window %q is empty", value)
+	}
+
+	return &Window{Start: start, End: end}, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// Returns whether the time is within the window, and when that occurrence of the window ends
+func (window *Window) Contains(t time.Time) (bool, time.Time) {
+	midnight := startOfDay(t)
+	sinceMidnight := t.Sub(midnight)
+
+	if window.Start < window.End {
+		if sinceMidnight >= window.Start && sinceMidnight < window.End {
+			return true, midnight.Add(window.End)
+		}
+
+		return false, time.Time{}
+	}
+
+	// The window spans midnight, so it either started yesterday or ends tomorrow
+	if sinceMidnight < window.End {
+		return true, midnight.Add(window.End)
+	}
+
+	if sinceMidnight >= window.Start {
+		return true, startOfDay(midnight.Add(day + time.Hour)).Add(window.End)
+	}
+
+	return false, time.Time{}
+}
+
+// Returns the time itself if it is within the window, or the next time the window opens
+func (window *Window) NextStart(t time.Time) time.Time {
+	if isWithin, _ := window.Contains(t); isWithin {
+		return t
+	}
+
+	start := startOfDay(t).Add(window.Start)
+	if start.Before(t) {
+		start = startOfDay(startOfDay(t).Add(day + time.Hour)).Add(window.Start)
+	}
+
+	return start
+}
+
+func (window *Window) String() string {
+	return fmt.Sprintf("%s-%s", formatTimeOfDay(window.Start), formatTimeOfDay(window.End))
+}
+
+func formatTimeOfDay(duration time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(duration.Hours()), int(duration.Minutes())%60)
+}
+
+// Days are not always 24 hours long when daylight saving time changes
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
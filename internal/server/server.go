@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+type Server struct {
+	Address string
+
+	mux *http.ServeMux
+}
+
+func New(address string) *Server {
+	return &Server{Address: address, mux: http.NewServeMux()}
+}
+
+func (server *Server) Handle(pattern string, handler http.Handler) {
+	server.mux.Handle(pattern, handler)
+}
+
+// Requires requests to authenticate with the token as a bearer token, and rejects them all if the token is empty
+func RequireToken(token string, handler http.Handler) http.Handler {
+	if token == "" {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+	}
+
+	expected := []byte("Bearer " + token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Serves in the background until ctx is cancelled, and only returns an error if the address can't be listened on
+func (server *Server) Start(ctx context.Context) error {
+	logger := slog.With("address", server.Address)
+
+	listener, err := net.Listen("tcp", server.Address)
+	if err != nil {
+		return err
+	}
+
+	httpServer := &http.Server{Handler: server.mux, ReadHeaderTimeout: 10 * time.Second}
+
+	context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		httpServer.Shutdown(shutdownCtx)
+	})
+
+	go func() {
+		logger.Info("Serving HTTP")
+
+		if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("HTTP server failed", "error", err)
+		}
+	}()
+
+	return nil
+}
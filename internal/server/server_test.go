@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireToken(t *testing.T) {
+	handler := RequireToken("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	tests := []struct {
+		authorization string
+		expected      int
+	}{
+		{"Bearer secret", http.StatusAccepted},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodPost, "/scan", nil)
+		if test.authorization != "" {
+			request.Header.Set("Authorization", test.authorization)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.expected {
+			t.Errorf("Expected status %d for %q, got %d", test.expected, test.authorization, recorder.Code)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	RequireToken("", handler).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/scan", nil))
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusForbidden, recorder.Code)
+	}
+}
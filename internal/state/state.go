@@ -0,0 +1,180 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const fileName = "state.json"
+
+func Open(dataDir string, policy RetryPolicy) (*Store, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	store := &Store{
+		path:   filepath.Join(dataDir, fileName),
+		policy: policy,
+		state:  state{Failures: map[int]Failure{}, Media: map[string]Media{}},
+	}
+
+	content, err := os.ReadFile(store.path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &store.state); err != nil {
+		return nil, err
+	}
+
+	if store.state.Failures == nil {
+		store.state.Failures = map[int]Failure{}
+	}
+
+	if store.state.Media == nil {
+		store.state.Media = map[string]Media{}
+	}
+
+	return store, nil
+}
+
+func (store *Store) Save() error {
+	store.mutex.Lock()
+	content, err := json.MarshalIndent(store.state, "", "  ")
+	store.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated state file behind
+	tempPath := store.path + ".tmp"
+
+	if err := os.WriteFile(tempPath, content, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, store.path)
+}
+
+func (store *Store) RecordFailure(bookmarkId int, bookmarkModified time.Time, url string, err error, undeletedAssetIds []int, now time.Time) Failure {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	failure := store.state.Failures[bookmarkId]
+	failure.BookmarkId = bookmarkId
+	failure.BookmarkModified = bookmarkModified
+	failure.Url = url
+	failure.Error = err.Error()
+	failure.Attempts++
+	failure.LastAttempt = now
+	failure.NextAttempt = now.Add(store.policy.delay(failure.Attempts))
+	failure.UndeletedAssetIds = undeletedAssetIds
+
+	store.state.Failures[bookmarkId] = failure
+	return failure
+}
+
+func (store *Store) Forget(bookmarkId int) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.state.Failures, bookmarkId)
+}
+
+// Starts the retries of the bookmark over, but remembers the assets that still have to be deleted
+func (store *Store) ResetRetries(bookmarkId int) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	failure, ok := store.state.Failures[bookmarkId]
+	if !ok {
+		return
+	}
+
+	if len(failure.UndeletedAssetIds) == 0 {
+		delete(store.state.Failures, bookmarkId)
+		return
+	}
+
+	store.state.Failures[bookmarkId] = Failure{BookmarkId: bookmarkId, Url: failure.Url, Error: failure.Error, UndeletedAssetIds: failure.UndeletedAssetIds}
+}
+
+func (store *Store) Failure(bookmarkId int) (Failure, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	failure, ok := store.state.Failures[bookmarkId]
+	return failure, ok
+}
+
+// Returns the failures that are eligible for another attempt, ordered by bookmark id
+func (store *Store) DueFailures(now time.Time) []Failure {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	due := make([]Failure, 0)
+
+	for _, failure := range store.state.Failures {
+		if store.IsDue(failure, now) {
+			due = append(due, failure)
+		}
+	}
+
+	slices.SortFunc(due, func(a, b Failure) int { return a.BookmarkId - b.BookmarkId })
+	return due
+}
+
+func (store *Store) IsDue(failure Failure, now time.Time) bool {
+	return !store.IsExhausted(failure) && !now.Before(failure.NextAttempt)
+}
+
+func (store *Store) IsExhausted(failure Failure) bool {
+	return store.policy.MaxAttempts > 0 && failure.Attempts >= store.policy.MaxAttempts
+}
+
+func (store *Store) Media(key string) (Media, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	media, ok := store.state.Media[key]
+	return media, ok
+}
+
+func (store *Store) RecordMedia(key string, media Media) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.state.Media[key] = media
+}
+
+func (store *Store) ForgetMedia(key string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.state.Media, key)
+}
+
+func (policy RetryPolicy) delay(attempts int) time.Duration {
+	delay := policy.InitialDelay
+
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+
+		if policy.MaxDelay > 0 && delay >= policy.MaxDelay {
+			return policy.MaxDelay
+		}
+	}
+
+	return delay
+}
@@ -0,0 +1,146 @@
+package state
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+var policy = RetryPolicy{InitialDelay: time.Hour, MaxDelay: 6 * time.Hour, MaxAttempts: 4}
+
+func TestRecordFailure(t *testing.T) {
+	store := openStore(t, t.TempDir())
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	expectedDelays := []time.Duration{time.Hour, 2 * time.Hour, 4 * time.Hour, 6 * time.Hour}
+
+	for i, expectedDelay := range expectedDelays {
+		failure := store.RecordFailure(42, now, "https://example.com", errors.New("download failed"), nil, now)
+
+		if failure.Attempts != i+1 {
+			t.Errorf("Expected %d attempts, got %d", i+1, failure.Attempts)
+		}
+
+		if delay := failure.NextAttempt.Sub(now); delay != expectedDelay {
+			t.Errorf("Expected delay %s after %d attempts, got %s", expectedDelay, failure.Attempts, delay)
+		}
+	}
+
+	failure, _ := store.Failure(42)
+	if !store.IsExhausted(failure) {
+		t.Error("Expected failure to be exhausted after the maximum number of attempts")
+	}
+
+	if store.IsDue(failure, now.Add(24*time.Hour)) {
+		t.Error("Expected exhausted failure to never be due")
+	}
+}
+
+func TestDueFailures(t *testing.T) {
+	store := openStore(t, t.TempDir())
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	store.RecordFailure(2, now, "https://example.com/2", errors.New("failed"), nil, now)
+	store.RecordFailure(1, now, "https://example.com/1", errors.New("failed"), nil, now.Add(-2*time.Hour))
+
+	due := store.DueFailures(now)
+	if len(due) != 1 || due[0].BookmarkId != 1 {
+		t.Fatalf("Expected only bookmark 1 to be due, got %+v", due)
+	}
+
+	due = store.DueFailures(now.Add(time.Hour))
+	if len(due) != 2 || due[0].BookmarkId != 1 || due[1].BookmarkId != 2 {
+		t.Fatalf("Expected bookmarks 1 and 2 to be due, got %+v", due)
+	}
+
+	store.Forget(1)
+
+	due = store.DueFailures(now.Add(time.Hour))
+	if len(due) != 1 || due[0].BookmarkId != 2 {
+		t.Fatalf("Expected only bookmark 2 to be due after forgetting bookmark 1, got %+v", due)
+	}
+}
+
+func TestResetRetries(t *testing.T) {
+	store := openStore(t, t.TempDir())
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	store.RecordFailure(1, now, "https://example.com/1", errors.New("failed"), nil, now)
+	store.RecordFailure(2, now, "https://example.com/2", errors.New("failed"), []int{7}, now)
+	store.RecordFailure(2, now, "https://example.com/2", errors.New("failed"), []int{7}, now)
+
+	store.ResetRetries(1)
+	store.ResetRetries(2)
+
+	if _, ok := store.Failure(1); ok {
+		t.Error("Expected failure without undeleted assets to be forgotten")
+	}
+
+	failure, ok := store.Failure(2)
+	if !ok || failure.Attempts != 0 || !slices.Equal(failure.UndeletedAssetIds, []int{7}) {
+		t.Fatalf("Expected retries to be reset and undeleted assets to be kept, got %+v", failure)
+	}
+
+	if !store.IsDue(failure, now) {
+		t.Error("Expected reset failure to be due")
+	}
+}
+
+func TestSaveAndOpen(t *testing.T) {
+	dataDir := t.TempDir()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	store := openStore(t, dataDir)
+	store.RecordFailure(42, now, "https://example.com", errors.New("download failed"), nil, now)
+
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openStore(t, dataDir)
+	failure, ok := reopened.Failure(42)
+
+	if !ok {
+		t.Fatal("Expected failure to be persisted")
+	}
+
+	if failure.Error != "download failed" || failure.Attempts != 1 || !failure.NextAttempt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Unexpected persisted failure: %+v", failure)
+	}
+}
+
+func openStore(t *testing.T, dataDir string) *Store {
+	store, err := Open(dataDir, policy)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestMedia(t *testing.T) {
+	dataDir := t.TempDir()
+	store := openStore(t, dataDir)
+
+	media := Media{BookmarkId: 42, Assets: []MediaAsset{{Id: 7, DisplayName: "video.mp4"}}, Title: "Video"}
+	store.RecordMedia("Youtube:RWGTIIO2QiQ", media)
+
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openStore(t, dataDir)
+	persisted, ok := reopened.Media("Youtube:RWGTIIO2QiQ")
+
+	if !ok || persisted.BookmarkId != 42 || len(persisted.Assets) != 1 || persisted.Assets[0].DisplayName != "video.mp4" {
+		t.Fatalf("Unexpected persisted media: %+v", persisted)
+	}
+
+	reopened.ForgetMedia("Youtube:RWGTIIO2QiQ")
+
+	if _, ok := reopened.Media("Youtube:RWGTIIO2QiQ"); ok {
+		t.Error("Expected media to be forgotten")
+	}
+}
@@ -0,0 +1,52 @@
+package state
+
+import (
+	"sync"
+	"time"
+)
+
+type Store struct {
+	path   string
+	policy RetryPolicy
+	mutex  sync.Mutex
+	state  state
+}
+
+type RetryPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	MaxAttempts  int
+}
+
+type Failure struct {
+	BookmarkId       int       `json:"bookmarkId"`
+	BookmarkModified time.Time `json:"bookmarkModified"`
+	Url              string    `json:"url"`
+	Error            string    `json:"error"`
+	Attempts         int       `json:"attempts"`
+	LastAttempt      time.Time `json:"lastAttempt"`
+	NextAttempt      time.Time `json:"nextAttempt"`
+
+	// Assets of a failed upload that couldn't be deleted, which have to be deleted before the next attempt
+	UndeletedAssetIds []int `json:"undeletedAssetIds,omitempty"`
+}
+
+// Media that was already uploaded to a bookmark, keyed by extractor and media id
+type Media struct {
+	BookmarkId  int          `json:"bookmarkId"`
+	Assets      []MediaAsset `json:"assets"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Tags        []string     `json:"tags"`
+	RecordedAt  time.Time    `json:"recordedAt"`
+}
+
+type MediaAsset struct {
+	Id          int    `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+type state struct {
+	Failures map[int]Failure  `json:"failures"`
+	Media    map[string]Media `json:"media"`
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package trigger
+
+import "context"
+
+// Signals to request a scan are only supported on Unix
+func (trigger *Trigger) OnSignal(ctx context.Context) {}
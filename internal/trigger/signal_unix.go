@@ -0,0 +1,31 @@
+//go:build unix
+
+package trigger
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Requests a scan whenever the process receives SIGHUP or SIGUSR1, until ctx is cancelled
+func (trigger *Trigger) OnSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR1)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case received := <-signals:
+				slog.Info("Scan requested", "signal", received.String())
+				trigger.Scan()
+			}
+		}
+	}()
+}
@@ -0,0 +1,116 @@
+package trigger
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+func New() *Trigger {
+	return &Trigger{wake: make(chan struct{}, 1)}
+}
+
+// Requests a scan of all bookmarks, combined with any other pending request
+func (trigger *Trigger) Scan() {
+	trigger.mutex.Lock()
+	defer trigger.mutex.Unlock()
+
+	trigger.pending.Scan = true
+	trigger.notify()
+}
+
+// Requests a single bookmark to be archived, regardless of whether it changed since the last scan
+func (trigger *Trigger) Archive(target string, bookmarkId int) {
+	trigger.mutex.Lock()
+	defer trigger.mutex.Unlock()
+
+	trigger.pending.addBookmarkId(target, bookmarkId)
+	trigger.notify()
+}
+
+// Receives when there is a pending request
+func (trigger *Trigger) C() <-chan struct{} {
+	return trigger.wake
+}
+
+// Returns the pending request and clears it
+func (trigger *Trigger) Take() Request {
+	trigger.mutex.Lock()
+	defer trigger.mutex.Unlock()
+
+	request := trigger.pending
+	trigger.pending = Request{}
+
+	// Drain a wake up for the request that was just taken
+	select {
+	case <-trigger.wake:
+	default:
+	}
+
+	return request
+}
+
+func (request Request) IsEmpty() bool {
+	return !request.Scan && len(request.BookmarkIds) == 0
+}
+
+func (request *Request) addBookmarkId(target string, bookmarkId int) {
+	if slices.Contains(request.BookmarkIds[target], bookmarkId) {
+		return
+	}
+
+	if request.BookmarkIds == nil {
+		request.BookmarkIds = map[string][]int{}
+	}
+
+	request.BookmarkIds[target] = append(request.BookmarkIds[target], bookmarkId)
+}
+
+func (trigger *Trigger) notify() {
+	select {
+	case trigger.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (trigger *Trigger) ScanHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("Scan requested")
+		trigger.Scan()
+		respond(w, http.StatusAccepted, "queued")
+	})
+}
+
+// Expects the bookmark ID in the id path value, and optionally one of the targets in the target path value (the first one otherwise)
+func (trigger *Trigger) ArchiveHandler(targets []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.PathValue("target")
+		if target == "" && len(targets) > 0 {
+			target = targets[0]
+		}
+
+		if !slices.Contains(targets, target) {
+			respond(w, http.StatusNotFound, "unknown target")
+			return
+		}
+
+		bookmarkId, err := strconv.Atoi(r.PathValue("id"))
+
+		if err != nil || bookmarkId <= 0 {
+			respond(w, http.StatusBadRequest, "invalid bookmark id")
+			return
+		}
+
+		slog.Info("Archiving bookmark requested", "target", target, "bookmarkId", bookmarkId)
+		trigger.Archive(target, bookmarkId)
+		respond(w, http.StatusAccepted, "queued")
+	})
+}
+
+func respond(w http.ResponseWriter, statusCode int, status string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
@@ -0,0 +1,79 @@
+package trigger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestTake(t *testing.T) {
+	trigger := New()
+	trigger.Archive("", 1)
+	trigger.Archive("", 2)
+	trigger.Archive("", 1)
+	trigger.Archive("team", 1)
+
+	select {
+	case <-trigger.C():
+	default:
+		t.Fatal("Expected a pending request")
+	}
+
+	trigger.Scan()
+	request := trigger.Take()
+
+	if !request.Scan || !slices.Equal(request.BookmarkIds[""], []int{1, 2}) || !slices.Equal(request.BookmarkIds["team"], []int{1}) {
+		t.Errorf("Unexpected request %+v", request)
+	}
+
+	if request := trigger.Take(); !request.IsEmpty() {
+		t.Errorf("Expected no request after taking it, got %+v", request)
+	}
+
+	select {
+	case <-trigger.C():
+		t.Error("Expected no wake up after taking the request")
+	default:
+	}
+}
+
+func TestArchiveHandler(t *testing.T) {
+	trigger := New()
+	mux := http.NewServeMux()
+	mux.Handle("POST /bookmarks/{id}/archive", trigger.ArchiveHandler([]string{"personal", "team"}))
+	mux.Handle("POST /targets/{target}/bookmarks/{id}/archive", trigger.ArchiveHandler([]string{"personal", "team"}))
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/bookmarks/42/archive", nil))
+
+	if recorder.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/bookmarks/abc/archive", nil))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/targets/team/bookmarks/7/archive", nil))
+
+	if recorder.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/targets/other/bookmarks/7/archive", nil))
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", recorder.Code)
+	}
+
+	request := trigger.Take()
+	if !slices.Equal(request.BookmarkIds["personal"], []int{42}) || !slices.Equal(request.BookmarkIds["team"], []int{7}) {
+		t.Errorf("Unexpected request %+v", request)
+	}
+}
@@ -0,0 +1,16 @@
+package trigger
+
+import "sync"
+
+// Collects requests for runs until the scan loop is ready for them, so runs never overlap
+type Trigger struct {
+	mutex   sync.Mutex
+	wake    chan struct{}
+	pending Request
+}
+
+// Bookmark IDs are only unique within a Linkding instance, so they are kept by target
+type Request struct {
+	Scan        bool
+	BookmarkIds map[string][]int
+}
@@ -1,22 +1,82 @@
 package ytdlp
 
+import (
+	"linkding-media-archiver/internal/ratelimit"
+	"linkding-media-archiver/internal/rules"
+	"time"
+)
+
 type Ytdlp struct {
 	DownloadDir string
 	Format      string
+	Limits      Limits
+	Rules       rules.Rules
+
+	// Shared by all concurrent downloads, unless a rule sets its own rate limit
+	RateLimit      ratelimit.Schedule
+	RateLimitShare int
+}
+
+// Empty fields fall back to the global settings
+type Profile struct {
+	Format            string
+	ExtractAudio      bool
+	AudioFormat       string
+	EmbedSubtitles    bool
+	SubtitleLanguages []string
+	EmbedThumbnail    bool
+	Limits            Limits
+}
+
+// Zero values mean no limit
+type Limits struct {
+	MaxDuration      time.Duration
+	MaxFilesize      int64
+	MaxTotalFilesize int64
+	MaxEntries       int
 }
 
 type DownloadResult struct {
-	Title       string
-	Description string
-	Tags        []string
-	Paths       []string
+	Title        string
+	Description  string
+	Tags         []string
+	Paths        []string
+	Dir          string
+	Extractor    string
+	ExtractorKey string
+}
+
+// Durations and file sizes are estimates summed across all entries of a playlist, and zero if unknown
+type ProbeResult struct {
+	Id           string
+	Extractor    string
+	ExtractorKey string
+	Duration     time.Duration
+	Filesize     int64
+	IsLive       bool
+	EntryCount   int
+}
+
+// Extractors are matched case-insensitively by either name (e.g. youtube:tab) or key (e.g. YoutubeTab)
+type ExtractorFilter struct {
+	Allow []string
+	Deny  []string
 }
 
 type jsonDump struct {
+	Id                 string              `json:"id"`
+	Extractor          string              `json:"extractor"`
+	ExtractorKey       string              `json:"extractor_key"`
 	Title              string              `json:"title"`
 	Description        string              `json:"description"`
 	Tags               []string            `json:"tags"`
+	Duration           float64             `json:"duration"`
+	IsLive             bool                `json:"is_live"`
+	LiveStatus         string              `json:"live_status"`
+	Filesize           float64             `json:"filesize"`
+	FilesizeApprox     float64             `json:"filesize_approx"`
 	Entries            []dumpEntry         `json:"entries"`
+	RequestedFormats   []requestedFormat   `json:"requested_formats"`
 	RequestedDownloads []requestedDownload `json:"requested_downloads"`
 }
 
@@ -24,9 +84,20 @@ type dumpEntry struct {
 	Title              string              `json:"title"`
 	Description        string              `json:"description"`
 	Tags               []string            `json:"tags"`
+	Duration           float64             `json:"duration"`
+	IsLive             bool                `json:"is_live"`
+	LiveStatus         string              `json:"live_status"`
+	Filesize           float64             `json:"filesize"`
+	FilesizeApprox     float64             `json:"filesize_approx"`
+	RequestedFormats   []requestedFormat   `json:"requested_formats"`
 	RequestedDownloads []requestedDownload `json:"requested_downloads"`
 }
 
+type requestedFormat struct {
+	Filesize       float64 `json:"filesize"`
+	FilesizeApprox float64 `json:"filesize_approx"`
+}
+
 type requestedDownload struct {
 	FilePath string `json:"filepath"`
 }
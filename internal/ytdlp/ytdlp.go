@@ -1,79 +1,250 @@
 package ytdlp
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log/slog"
+	"linkding-media-archiver/internal/logging"
+	"linkding-media-archiver/internal/metrics"
 	"os"
 	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
+var ErrUnsupportedUrl = errors.New("unsupported URL")
+var ErrTooLarge = errors.New("too large")
+
 func NewYtdlp(downloadDir string, format string) *Ytdlp {
 	return &Ytdlp{DownloadDir: downloadDir, Format: format}
 }
 
-func (ytdlp *Ytdlp) DownloadMedia(url string) (*DownloadResult, error) {
-	logger := slog.With("url", url)
-
+// The files are downloaded into a directory of their own, which is removed along with them by DownloadResult.Remove
+func (ytdlp *Ytdlp) DownloadMedia(ctx context.Context, url string, profile Profile) (*DownloadResult, error) {
 	tempdir, err := os.MkdirTemp(ytdlp.DownloadDir, "media")
 
 	if err != nil {
 		return nil, err
 	}
 
-	cmd := ytdlp.cmd(url)
+	start := time.Now()
+	result, err := ytdlp.download(ctx, url, profile, tempdir)
+	metrics.YtdlpDuration.ObserveSince(start, "download", metricResult(err))
+
+	if err != nil {
+		os.RemoveAll(tempdir)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ytdlp *Ytdlp) download(ctx context.Context, url string, profile Profile, tempdir string) (*DownloadResult, error) {
+	logger := logging.FromContext(ctx).With("url", url)
+
+	cmd := ytdlp.cmd(ctx, url, profile, false)
 	cmd.Dir = tempdir
 
 	logger.Debug("Downloading media", "command", cmd.String())
-	output, err := cmd.Output()
+	jsonDump, err := run(ctx, cmd, url)
 
 	if err != nil {
-		exitErr, ok := err.(*exec.ExitError)
+		return nil, err
+	}
 
-		var stderr string
-		if ok {
-			stderr = string(exitErr.Stderr)
-		}
+	result := newDownloadResult(jsonDump)
+	result.Dir = tempdir
+	logger.Debug("Downloaded media", "result", result)
 
-		logger.Error("yt-dlp error", "stderr", stderr)
+	limits := ytdlp.EffectiveLimits(profile)
+
+	// yt-dlp silently skips files that don't pass the filters
+	if len(result.Paths) == 0 && limits.IsSet() {
+		return nil, fmt.Errorf("%w: no files within the limits", ErrTooLarge)
+	}
+
+	if len(result.Paths) == 0 {
+		return nil, fmt.Errorf("no paths in download result: %+v", result)
+	}
+
+	if err := limits.checkFiles(result.Paths); err != nil {
 		return nil, err
 	}
 
-	var jsonDump jsonDump
-	err = json.Unmarshal(output, &jsonDump)
+	return &result, nil
+}
+
+// Runs yt-dlp to check that it is installed and working
+func (ytdlp *Ytdlp) Version(ctx context.Context) (string, error) {
+	output, err := exec.CommandContext(ctx, "yt-dlp", "--version").Output()
 
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	result := newDownloadResult(&jsonDump)
-	logger.Debug("Downloaded media", "result", result)
+	return strings.TrimSpace(string(output)), nil
+}
 
-	if len(result.Paths) == 0 {
-		return nil, fmt.Errorf("no paths in download result: %+v", result)
+// The budget at the time a download starts applies for all of it, since yt-dlp can't change its rate while running
+func (ytdlp *Ytdlp) rateLimit(now time.Time) int64 {
+	rate := ytdlp.RateLimit.At(now)
+
+	if rate <= 0 {
+		return 0
 	}
 
+	return max(1, rate/int64(max(1, ytdlp.RateLimitShare)))
+}
+
+func metricResult(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrUnsupportedUrl):
+		return "unsupported"
+	case errors.Is(err, ErrTooLarge):
+		return "too_large"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	default:
+		return "error"
+	}
+}
+
+func (result *DownloadResult) Remove() {
+	for _, path := range result.Paths {
+		os.Remove(path)
+	}
+
+	// yt-dlp may leave other files behind, such as partial downloads and thumbnails
+	if result.Dir != "" {
+		os.RemoveAll(result.Dir)
+	}
+}
+
+// Retrieves metadata about the media at the URL without downloading anything
+func (ytdlp *Ytdlp) Probe(ctx context.Context, url string, profile Profile) (*ProbeResult, error) {
+	logger := logging.FromContext(ctx).With("url", url)
+
+	cmd := ytdlp.cmd(ctx, url, profile, true)
+
+	logger.Debug("Probing media", "command", cmd.String())
+	start := time.Now()
+	jsonDump, err := run(ctx, cmd, url)
+	metrics.YtdlpDuration.ObserveSince(start, "probe", metricResult(err))
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := newProbeResult(jsonDump)
+	logger.Debug("Probed media", "result", result)
+
 	return &result, nil
 }
 
-func (ytdlp *Ytdlp) cmd(url string) *exec.Cmd {
+// Limits of the profile take precedence over the global limits
+func (ytdlp *Ytdlp) EffectiveLimits(profile Profile) Limits {
+	return Limits{
+		MaxDuration:      cmp.Or(profile.Limits.MaxDuration, ytdlp.Limits.MaxDuration),
+		MaxFilesize:      cmp.Or(profile.Limits.MaxFilesize, ytdlp.Limits.MaxFilesize),
+		MaxTotalFilesize: cmp.Or(profile.Limits.MaxTotalFilesize, ytdlp.Limits.MaxTotalFilesize),
+		MaxEntries:       cmp.Or(profile.Limits.MaxEntries, ytdlp.Limits.MaxEntries),
+	}
+}
+
+func (ytdlp *Ytdlp) cmd(ctx context.Context, url string, profile Profile, simulate bool) *exec.Cmd {
 	args := []string{
-		"--no-simulate",
 		"--restrict-filenames",
 		"--dump-single-json",
 	}
 
+	if simulate {
+		args = append(args, "--simulate")
+	} else {
+		args = append(args, "--no-simulate")
+	}
+
+	rule, _ := ytdlp.Rules.Match(url)
+	format := cmp.Or(profile.Format, rule.Format, ytdlp.Format)
+
 	// https://github.com/yt-dlp/yt-dlp?tab=readme-ov-file#format-selection
-	if len(ytdlp.Format) > 0 {
-		args = append(args, "--format", ytdlp.Format)
+	if len(format) > 0 {
+		args = append(args, "--format", format)
+	}
+
+	// https://github.com/yt-dlp/yt-dlp?tab=readme-ov-file#sorting-formats
+	if len(rule.FormatSort) > 0 {
+		args = append(args, "--format-sort", rule.FormatSort)
+	}
+
+	if len(rule.RateLimit) > 0 {
+		args = append(args, "--limit-rate", rule.RateLimit)
+	} else if rate := ytdlp.rateLimit(time.Now()); rate > 0 {
+		args = append(args, "--limit-rate", strconv.FormatInt(rate, 10))
 	}
 
+	args = append(args, profile.args()...)
+
+	// Probing must see all entries, otherwise the limits could never be exceeded
+	if !simulate {
+		args = append(args, ytdlp.EffectiveLimits(profile).args()...)
+	}
+
+	args = append(args, rule.Args...)
+
 	args = append(args, url)
-	cmd := exec.Command("yt-dlp", args...)
+	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+
+	// Interrupt rather than kill yt-dlp when cancelled so it can clean up partial downloads
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 10 * time.Second
 
 	return cmd
 }
 
+func run(ctx context.Context, cmd *exec.Cmd, url string) (*jsonDump, error) {
+	logger := logging.FromContext(ctx).With("url", url)
+	output, err := cmd.Output()
+
+	if ctx.Err() != nil {
+		logger.Info("yt-dlp was cancelled")
+		return nil, ctx.Err()
+	}
+
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+
+		var stderr string
+		if ok {
+			stderr = string(exitErr.Stderr)
+		}
+
+		logger.Error("yt-dlp error", "stderr", stderr)
+
+		if strings.Contains(stderr, "Unsupported URL") {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedUrl, url)
+		}
+
+		return nil, err
+	}
+
+	var jsonDump jsonDump
+	err = json.Unmarshal(output, &jsonDump)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &jsonDump, nil
+}
+
 func newDownloadResult(jsonDump *jsonDump) DownloadResult {
 	paths := make([]string, 0, len(jsonDump.RequestedDownloads)+len(jsonDump.Entries))
 
@@ -88,9 +259,168 @@ func newDownloadResult(jsonDump *jsonDump) DownloadResult {
 	}
 
 	return DownloadResult{
-		Title:       jsonDump.Title,
-		Description: jsonDump.Description,
-		Tags:        jsonDump.Tags,
-		Paths:       paths,
+		Title:        jsonDump.Title,
+		Description:  jsonDump.Description,
+		Tags:         jsonDump.Tags,
+		Paths:        paths,
+		Extractor:    jsonDump.Extractor,
+		ExtractorKey: jsonDump.ExtractorKey,
+	}
+}
+
+func newProbeResult(jsonDump *jsonDump) ProbeResult {
+	result := ProbeResult{
+		Id:           jsonDump.Id,
+		Extractor:    jsonDump.Extractor,
+		ExtractorKey: jsonDump.ExtractorKey,
+		IsLive:       isLive(jsonDump.IsLive, jsonDump.LiveStatus),
+		EntryCount:   len(jsonDump.Entries),
+	}
+
+	if len(jsonDump.Entries) == 0 {
+		result.Duration = seconds(jsonDump.Duration)
+		result.Filesize = estimateFilesize(jsonDump.Filesize, jsonDump.FilesizeApprox, jsonDump.RequestedFormats)
+	}
+
+	for _, entry := range jsonDump.Entries {
+		result.Duration += seconds(entry.Duration)
+		result.Filesize += estimateFilesize(entry.Filesize, entry.FilesizeApprox, entry.RequestedFormats)
+		result.IsLive = result.IsLive || isLive(entry.IsLive, entry.LiveStatus)
+	}
+
+	return result
+}
+
+// Merged formats (e.g. separate video and audio streams) report their sizes individually
+func estimateFilesize(filesize float64, filesizeApprox float64, requestedFormats []requestedFormat) int64 {
+	if len(requestedFormats) > 0 {
+		var total int64
+
+		for _, format := range requestedFormats {
+			total += estimateFilesize(format.Filesize, format.FilesizeApprox, nil)
+		}
+
+		return total
+	}
+
+	if filesize > 0 {
+		return int64(filesize)
+	}
+
+	return int64(filesizeApprox)
+}
+
+func isLive(isLive bool, liveStatus string) bool {
+	return isLive || liveStatus == "is_live" || liveStatus == "is_upcoming"
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
+
+func (profile Profile) args() []string {
+	args := make([]string, 0)
+
+	if profile.ExtractAudio {
+		args = append(args, "--extract-audio")
+
+		if len(profile.AudioFormat) > 0 {
+			args = append(args, "--audio-format", profile.AudioFormat)
+		}
+	}
+
+	// Subtitles and thumbnails are embedded because separate files can't be uploaded as media assets
+	if profile.EmbedSubtitles {
+		args = append(args, "--write-subs", "--embed-subs")
+
+		if len(profile.SubtitleLanguages) > 0 {
+			args = append(args, "--sub-langs", strings.Join(profile.SubtitleLanguages, ","))
+		}
+	}
+
+	if profile.EmbedThumbnail {
+		args = append(args, "--embed-thumbnail")
+	}
+
+	return args
+}
+
+func (limits Limits) IsSet() bool {
+	return limits != Limits{}
+}
+
+// Checks the metadata of the media against the limits before downloading it
+func (limits Limits) Check(probe ProbeResult) error {
+	if limits.MaxDuration > 0 && probe.Duration > limits.MaxDuration {
+		return fmt.Errorf("%w: duration %s exceeds %s", ErrTooLarge, probe.Duration, limits.MaxDuration)
+	}
+
+	if limits.MaxTotalFilesize > 0 && probe.Filesize > limits.MaxTotalFilesize {
+		return fmt.Errorf("%w: estimated size of %d bytes exceeds %d bytes", ErrTooLarge, probe.Filesize, limits.MaxTotalFilesize)
+	}
+
+	if limits.MaxFilesize > 0 && probe.EntryCount == 0 && probe.Filesize > limits.MaxFilesize {
+		return fmt.Errorf("%w: estimated size of %d bytes exceeds %d bytes", ErrTooLarge, probe.Filesize, limits.MaxFilesize)
 	}
+
+	if limits.MaxEntries > 0 && probe.EntryCount > limits.MaxEntries {
+		return fmt.Errorf("%w: %d entries exceed %d entries", ErrTooLarge, probe.EntryCount, limits.MaxEntries)
+	}
+
+	return nil
+}
+
+// Enforces the limits while downloading, in case the metadata was incomplete
+func (limits Limits) args() []string {
+	args := make([]string, 0)
+
+	if limits.MaxFilesize > 0 {
+		args = append(args, "--max-filesize", strconv.FormatInt(limits.MaxFilesize, 10))
+	}
+
+	// Media with an unknown duration is allowed through
+	if limits.MaxDuration > 0 {
+		args = append(args, "--match-filters", fmt.Sprintf("duration <=? %d", int(limits.MaxDuration.Seconds())))
+	}
+
+	if limits.MaxEntries > 0 {
+		args = append(args, "--playlist-items", fmt.Sprintf(":%d", limits.MaxEntries))
+	}
+
+	return args
+}
+
+func (limits Limits) checkFiles(paths []string) error {
+	if limits.MaxTotalFilesize <= 0 {
+		return nil
+	}
+
+	var total int64
+
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		total += stat.Size()
+	}
+
+	if total > limits.MaxTotalFilesize {
+		return fmt.Errorf("%w: total size of %d bytes exceeds %d bytes", ErrTooLarge, total, limits.MaxTotalFilesize)
+	}
+
+	return nil
+}
+
+func (filter ExtractorFilter) IsAllowed(extractor string, extractorKey string) bool {
+	matches := func(name string) bool {
+		return strings.EqualFold(name, extractor) || strings.EqualFold(name, extractorKey)
+	}
+
+	if len(filter.Allow) > 0 && !slices.ContainsFunc(filter.Allow, matches) {
+		return false
+	}
+
+	return !slices.ContainsFunc(filter.Deny, matches)
 }
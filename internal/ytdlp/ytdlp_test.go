@@ -1,16 +1,20 @@
 package ytdlp
 
 import (
+	"encoding/json"
+	"errors"
+	"linkding-media-archiver/internal/ratelimit"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestDownloadMedia(t *testing.T) {
 	ytdlp := NewYtdlp(t.TempDir(), "")
-	result, err := ytdlp.DownloadMedia("https://www.youtube.com/watch?v=RWGTIIO2QiQ")
+	result, err := ytdlp.DownloadMedia(t.Context(), "https://www.youtube.com/watch?v=RWGTIIO2QiQ", Profile{})
 
 	if err != nil {
 		t.Fatal(err)
@@ -41,6 +45,10 @@ func TestDownloadMedia(t *testing.T) {
 		t.Errorf("Unexpected description: %s", result.Description)
 	}
 
+	if result.Extractor != "youtube" || result.ExtractorKey != "Youtube" {
+		t.Errorf("Unexpected extractor: %s (%s)", result.Extractor, result.ExtractorKey)
+	}
+
 	expectedTags := []string{"tokyo station melody", "yamanote line jingle", "駅のメロディー"}
 	for _, tag := range expectedTags {
 		if !slices.Contains(result.Tags, tag) {
@@ -51,7 +59,7 @@ func TestDownloadMedia(t *testing.T) {
 
 func TestDownloadMediaWithFormatSelection(t *testing.T) {
 	ytdlp := NewYtdlp(t.TempDir(), "bestaudio[ext=m4a]")
-	result, err := ytdlp.DownloadMedia("https://www.youtube.com/watch?v=RWGTIIO2QiQ")
+	result, err := ytdlp.DownloadMedia(t.Context(), "https://www.youtube.com/watch?v=RWGTIIO2QiQ", Profile{})
 
 	if err != nil {
 		t.Fatal(err)
@@ -75,9 +83,27 @@ func TestDownloadMediaWithFormatSelection(t *testing.T) {
 	}
 }
 
+func TestDownloadMediaWithProfile(t *testing.T) {
+	ytdlp := NewYtdlp(t.TempDir(), "")
+	profile := Profile{Format: "bestaudio[ext=m4a]", EmbedThumbnail: true}
+	result, err := ytdlp.DownloadMedia(t.Context(), "https://www.youtube.com/watch?v=RWGTIIO2QiQ", profile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Paths) != 1 {
+		t.Fatalf("Expected single file, was %d", len(result.Paths))
+	}
+
+	if ext := filepath.Ext(result.Paths[0]); ext != ".m4a" {
+		t.Errorf("Unexpected file extension: %s", ext)
+	}
+}
+
 func TestDownloadMediaWithMultipleFiles(t *testing.T) {
 	ytdlp := NewYtdlp(t.TempDir(), "")
-	result, err := ytdlp.DownloadMedia("https://www.youtube.com/playlist?list=PLSBoMdEkRnhQCyNGzVR66TgY93bJcTfsc")
+	result, err := ytdlp.DownloadMedia(t.Context(), "https://www.youtube.com/playlist?list=PLSBoMdEkRnhQCyNGzVR66TgY93bJcTfsc", Profile{})
 
 	if err != nil {
 		t.Fatal(err)
@@ -101,3 +127,177 @@ func TestDownloadMediaWithMultipleFiles(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractorFilter(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       ExtractorFilter
+		extractor    string
+		extractorKey string
+		expected     bool
+	}{
+		{"empty", ExtractorFilter{}, "generic", "Generic", true},
+		{"allow by name", ExtractorFilter{Allow: []string{"youtube"}}, "youtube", "Youtube", true},
+		{"allow by key", ExtractorFilter{Allow: []string{"youtubetab"}}, "youtube:tab", "YoutubeTab", true},
+		{"not allowed", ExtractorFilter{Allow: []string{"youtube"}}, "soundcloud", "Soundcloud", false},
+		{"denied", ExtractorFilter{Deny: []string{"generic"}}, "generic", "Generic", false},
+		{"not denied", ExtractorFilter{Deny: []string{"generic"}}, "youtube", "Youtube", true},
+		{"allowed and denied", ExtractorFilter{Allow: []string{"youtube"}, Deny: []string{"Youtube"}}, "youtube", "Youtube", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := test.filter.IsAllowed(test.extractor, test.extractorKey)
+
+			if actual != test.expected {
+				t.Errorf("Expected %s to be allowed: %t, was %t", test.extractor, test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestProbe(t *testing.T) {
+	ytdlp := NewYtdlp(t.TempDir(), "")
+	result, err := ytdlp.Probe(t.Context(), "https://www.youtube.com/watch?v=RWGTIIO2QiQ", Profile{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Id != "RWGTIIO2QiQ" || result.ExtractorKey != "Youtube" {
+		t.Errorf("Unexpected media: %s (%s)", result.Id, result.ExtractorKey)
+	}
+
+	if result.Duration <= 0 || result.Filesize <= 0 {
+		t.Errorf("Expected duration and file size estimates, got %s and %d", result.Duration, result.Filesize)
+	}
+
+	if result.IsLive || result.EntryCount != 0 {
+		t.Errorf("Expected single video, got live %t with %d entries", result.IsLive, result.EntryCount)
+	}
+}
+
+func TestNewProbeResult(t *testing.T) {
+	dump := `{
+		"id": "playlist",
+		"extractor": "youtube:tab",
+		"extractor_key": "YoutubeTab",
+		"entries": [
+			{"duration": 60.5, "filesize": 1000, "live_status": "not_live"},
+			{"duration": 30, "filesize": null, "filesize_approx": 500.7, "is_live": null},
+			{"duration": 10, "requested_formats": [{"filesize": 200}, {"filesize_approx": 100}], "live_status": "is_upcoming"}
+		]
+	}`
+
+	var jsonDump jsonDump
+	if err := json.Unmarshal([]byte(dump), &jsonDump); err != nil {
+		t.Fatal(err)
+	}
+
+	result := newProbeResult(&jsonDump)
+
+	if result.EntryCount != 3 {
+		t.Errorf("Expected 3 entries, got %d", result.EntryCount)
+	}
+
+	if expected := 100500 * time.Millisecond; result.Duration != expected {
+		t.Errorf("Expected duration %s, got %s", expected, result.Duration)
+	}
+
+	if result.Filesize != 1800 {
+		t.Errorf("Expected file size 1800, got %d", result.Filesize)
+	}
+
+	if !result.IsLive {
+		t.Error("Expected upcoming entry to be treated as live")
+	}
+}
+
+func TestLimitsCheck(t *testing.T) {
+	limits := Limits{MaxDuration: time.Hour, MaxFilesize: 1000, MaxTotalFilesize: 5000, MaxEntries: 10}
+
+	tests := []struct {
+		name     string
+		probe    ProbeResult
+		expected bool
+	}{
+		{"within limits", ProbeResult{Duration: 30 * time.Minute, Filesize: 900}, true},
+		{"unknown", ProbeResult{}, true},
+		{"too long", ProbeResult{Duration: 2 * time.Hour}, false},
+		{"file too large", ProbeResult{Filesize: 2000}, false},
+		{"playlist within limits", ProbeResult{Filesize: 4000, EntryCount: 5}, true},
+		{"playlist too large", ProbeResult{Filesize: 6000, EntryCount: 5}, false},
+		{"too many entries", ProbeResult{EntryCount: 11}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := limits.Check(test.probe)
+
+			if (err == nil) != test.expected {
+				t.Errorf("Expected probe to be within limits: %t, got error %v", test.expected, err)
+			}
+
+			if err != nil && !errors.Is(err, ErrTooLarge) {
+				t.Errorf("Expected error to be ErrTooLarge, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProbeLimits(t *testing.T) {
+	ytdlp := NewYtdlp(t.TempDir(), "")
+	ytdlp.Limits = Limits{MaxDuration: time.Hour, MaxEntries: 2}
+
+	probeArgs := ytdlp.cmd(t.Context(), "https://example.com/playlist", Profile{}, true).Args
+	downloadArgs := ytdlp.cmd(t.Context(), "https://example.com/playlist", Profile{}, false).Args
+
+	for _, arg := range []string{"--playlist-items", "--match-filters"} {
+		if slices.Contains(probeArgs, arg) {
+			t.Errorf("Expected probe not to pass %s, got %v", arg, probeArgs)
+		}
+
+		if !slices.Contains(downloadArgs, arg) {
+			t.Errorf("Expected download to pass %s, got %v", arg, downloadArgs)
+		}
+	}
+
+	dump := `{"id": "playlist", "entries": [{"duration": 60}, {"duration": 60}, {"duration": 60}]}`
+
+	var jsonDump jsonDump
+	if err := json.Unmarshal([]byte(dump), &jsonDump); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ytdlp.Limits.Check(newProbeResult(&jsonDump)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected playlist with too many entries to be rejected, got %v", err)
+	}
+}
+
+func TestEffectiveLimits(t *testing.T) {
+	ytdlp := NewYtdlp(t.TempDir(), "")
+	ytdlp.Limits = Limits{MaxDuration: time.Hour, MaxFilesize: 1000}
+
+	limits := ytdlp.EffectiveLimits(Profile{Limits: Limits{MaxFilesize: 5000, MaxEntries: 3}})
+	expected := Limits{MaxDuration: time.Hour, MaxFilesize: 5000, MaxEntries: 3}
+
+	if limits != expected {
+		t.Errorf("Expected limits %+v, got %+v", expected, limits)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ytdlp := NewYtdlp(t.TempDir(), "")
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if rate := ytdlp.rateLimit(now); rate != 0 {
+		t.Errorf("Expected no rate limit, got %d", rate)
+	}
+
+	ytdlp.RateLimit = ratelimit.Schedule{Default: 3000}
+	ytdlp.RateLimitShare = 2
+
+	if rate := ytdlp.rateLimit(now); rate != 1500 {
+		t.Errorf("Expected rate limit to be shared between downloads, got %d", rate)
+	}
+}